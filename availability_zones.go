@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/availabilityzones"
+)
+
+// availabilityZones returns the zones module is run in, the available compute
+// zones of cloud are listed when the module discovers them
+func availabilityZones(ctx context.Context, cloud *cloudConfig, module *moduleConfig) ([]string, error) {
+	if !module.DiscoverAvailabilityZones {
+		return module.AvailabilityZones, nil
+	}
+
+	provider, err := getProvider(ctx, cloud)
+
+	if err != nil {
+		return nil, err
+	}
+
+	computeClient, err := openstack.NewComputeV2(provider, cloud.endpointOpts())
+
+	if err != nil {
+		return nil, fmt.Errorf("nova client failure: %w", err)
+	}
+
+	page, err := availabilityzones.List(computeClient).AllPages()
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot list availability zones: %w", err)
+	}
+
+	allZones, err := availabilityzones.ExtractAvailabilityZones(page)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var zones []string
+
+	for _, zone := range allZones {
+		if zone.ZoneState.Available {
+			zones = append(zones, zone.ZoneName)
+		}
+	}
+
+	if len(zones) == 0 {
+		return nil, withReason(reasonNotFound, fmt.Errorf("no available availability zone"))
+	}
+
+	sort.Strings(zones)
+
+	return zones, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSpawnAvailabilityZones(t *testing.T) {
+	tests := []struct {
+		name     string
+		zones    []string
+		discover bool
+		// volumeZone is the volume_availability_zone of the module
+		volumeZone string
+		// success tells whether the run in each zone succeeded
+		success map[string]float64
+	}{
+		{
+			name:     "discovered",
+			discover: true,
+			success:  map[string]float64{"az1": 1, "az2": 1},
+		},
+		{
+			name:    "configured",
+			zones:   []string{"az1", "az3"},
+			success: map[string]float64{"az1": 1, "az3": 0},
+		},
+		{
+			name:       "volume zone",
+			zones:      []string{"az1", "az2"},
+			volumeZone: "nova",
+			success:    map[string]float64{"az1": 1, "az2": 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, _, module := newSpawnFixture(t, "spawn")
+			f.availabilityZones = map[string]bool{"az1": true, "az2": true, "az3": false}
+
+			module.AvailabilityZones = test.zones
+			module.DiscoverAvailabilityZones = test.discover
+			module.VolumeAvailabilityZone = test.volumeZone
+
+			if err := module.validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			result := runTestProbe(t, module, f.cloud())
+
+			for zone, want := range test.success {
+				labels := map[string]string{"availability_zone": zone}
+
+				if value, ok := result.value(t, "openstack_client_spawn_success", labels); !ok || value != want {
+					t.Errorf("zone %s: got success %v (%v), want %v", zone, value, ok, want)
+				}
+
+				if _, ok := result.value(t, "openstack_client_spawn_timing", labels); !ok {
+					t.Errorf("zone %s: no timing", zone)
+				}
+			}
+
+			if len(f.servers.objects) != len(test.success) {
+				t.Fatalf("got %d servers, want %d", len(f.servers.objects), len(test.success))
+			}
+
+			zones := map[string]bool{}
+
+			for _, server := range f.servers.list() {
+				zone, _ := server["availability_zone"].(string)
+				zones[zone] = true
+			}
+
+			volumeZones := map[string]bool{}
+
+			for _, volume := range f.volumes.list() {
+				zone, _ := volume["availability_zone"].(string)
+				volumeZones[zone] = true
+
+				if test.volumeZone != "" && zone != test.volumeZone {
+					t.Errorf("volume created in zone %q, want %q", zone, test.volumeZone)
+				}
+			}
+
+			for zone := range test.success {
+				if !zones[zone] {
+					t.Errorf("no server created in zone %s: %v", zone, zones)
+				}
+
+				if test.volumeZone == "" && !volumeZones[zone] {
+					t.Errorf("no boot volume created in zone %s: %v", zone, volumeZones)
+				}
+			}
+		})
+	}
+}
+
+func TestAvailabilityZonesValidation(t *testing.T) {
+	module := testModule("object_store")
+	module.AvailabilityZones = []string{"az1"}
+
+	if err := module.validate(); err == nil {
+		t.Error("got no error for availability zones on the object_store prober")
+	}
+}
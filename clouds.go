@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"gopkg.in/yaml.v2"
+)
+
+// cloudsFile is the content of clouds.yaml and secure.yaml
+type cloudsFile struct {
+	Clouds map[string]*cloudConfig `yaml:"clouds"`
+}
+
+// defaultCloud is the cloud selected by OS_CLOUD and the OS_* environment
+// variables, it is the one probed for /metrics
+var defaultCloud = &cloudConfig{}
+
+var (
+	// usedClouds holds the clouds of clouds.yaml probed through /probe, they
+	// are garbage collected along with the ones of the configuration file
+	usedCloudsMutex sync.Mutex
+	usedClouds      = map[string]*cloudConfig{}
+)
+
+// findCloudsFile returns the first existing file among the ones named by the
+// given environment variable and the standard OpenStack client search paths
+func findCloudsFile(envVariable string, fileName string) string {
+	if path := os.Getenv(envVariable); path != "" {
+		return path
+	}
+
+	paths := []string{fileName}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".config", "openstack", fileName))
+	}
+
+	paths = append(paths, filepath.Join("/etc", "openstack", fileName))
+
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	return ""
+}
+
+func readYAML(path string) (map[interface{}]interface{}, error) {
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[interface{}]interface{}{}
+
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %s", path, err)
+	}
+
+	return values, nil
+}
+
+// mergeYAML recursively copies the values of src into dst
+func mergeYAML(dst map[interface{}]interface{}, src map[interface{}]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[interface{}]interface{})
+		dstMap, dstIsMap := dst[key].(map[interface{}]interface{})
+
+		if srcIsMap && dstIsMap {
+			mergeYAML(dstMap, srcMap)
+		} else {
+			dst[key] = value
+		}
+	}
+}
+
+// loadCloudsFile reads clouds.yaml and merges secure.yaml into it, both being
+// looked up like the OpenStack command line clients do
+func loadCloudsFile() (*cloudsFile, error) {
+	values := map[interface{}]interface{}{}
+
+	for _, file := range []struct{ env, name string }{
+		{"OS_CLIENT_CONFIG_FILE", "clouds.yaml"},
+		{"OS_CLIENT_SECURE_FILE", "secure.yaml"},
+	} {
+		path := findCloudsFile(file.env, file.name)
+
+		if path == "" {
+			continue
+		}
+
+		fileValues, err := readYAML(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		mergeYAML(values, fileValues)
+	}
+
+	// Go through YAML again to decode the merged values into our structures
+	content, err := yaml.Marshal(values)
+
+	if err != nil {
+		return nil, err
+	}
+
+	clouds := &cloudsFile{}
+
+	if err := yaml.Unmarshal(content, clouds); err != nil {
+		return nil, fmt.Errorf("cannot parse clouds.yaml: %s", err)
+	}
+
+	for name, cloud := range clouds.Clouds {
+		if cloud == nil {
+			clouds.Clouds[name] = &cloudConfig{}
+		}
+
+		clouds.Clouds[name].name = name
+	}
+
+	return clouds, nil
+}
+
+// setFromEnv overrides value with the content of an environment variable when set
+func setFromEnv(value *string, name string) {
+	if v := os.Getenv(name); v != "" {
+		*value = v
+	}
+}
+
+// envCloud returns the cloud named by OS_CLOUD in clouds.yaml, if any, with
+// the other OS_* environment variables taking precedence over its settings
+func envCloud() (*cloudConfig, error) {
+	cloud := &cloudConfig{}
+
+	if cloudName := os.Getenv("OS_CLOUD"); cloudName != "" {
+		clouds, err := loadCloudsFile()
+
+		if err != nil {
+			return nil, err
+		}
+
+		c, ok := clouds.Clouds[cloudName]
+
+		if !ok {
+			return nil, fmt.Errorf("cloud %s not found in clouds.yaml", cloudName)
+		}
+
+		cloud = c
+		// The cloud probed for /metrics is never labelled
+		cloud.name = ""
+	}
+
+	setFromEnv(&cloud.Auth.AuthURL, "OS_AUTH_URL")
+	setFromEnv(&cloud.Auth.Username, "OS_USERNAME")
+	setFromEnv(&cloud.Auth.UserID, "OS_USER_ID")
+	setFromEnv(&cloud.Auth.Password, "OS_PASSWORD")
+	setFromEnv(&cloud.Auth.UserDomainName, "OS_USER_DOMAIN_NAME")
+	setFromEnv(&cloud.Auth.UserDomainID, "OS_USER_DOMAIN_ID")
+	setFromEnv(&cloud.Auth.ProjectName, "OS_PROJECT_NAME")
+	setFromEnv(&cloud.Auth.ProjectID, "OS_PROJECT_ID")
+	setFromEnv(&cloud.Auth.ProjectDomainName, "OS_PROJECT_DOMAIN_NAME")
+	setFromEnv(&cloud.Auth.ProjectDomainID, "OS_PROJECT_DOMAIN_ID")
+	setFromEnv(&cloud.Auth.ApplicationCredentialID, "OS_APPLICATION_CREDENTIAL_ID")
+	setFromEnv(&cloud.Auth.ApplicationCredentialName, "OS_APPLICATION_CREDENTIAL_NAME")
+	setFromEnv(&cloud.Auth.ApplicationCredentialSecret, "OS_APPLICATION_CREDENTIAL_SECRET")
+	setFromEnv(&cloud.Auth.Token, "OS_TOKEN")
+	setFromEnv(&cloud.AuthType, "OS_AUTH_TYPE")
+	setFromEnv(&cloud.RegionName, "OS_REGION_NAME")
+
+	return cloud, nil
+}
+
+// getCloud returns the named cloud, clouds of the configuration file take
+// precedence over the ones of clouds.yaml
+func getCloud(name string) (*cloudConfig, error) {
+	if cloud, ok := configuration.Clouds[name]; ok {
+		return cloud, nil
+	}
+
+	clouds, err := loadCloudsFile()
+
+	if err != nil {
+		return nil, err
+	}
+
+	cloud, ok := clouds.Clouds[name]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown cloud %q", name)
+	}
+
+	usedCloudsMutex.Lock()
+	usedClouds[name] = cloud
+	usedCloudsMutex.Unlock()
+
+	return cloud, nil
+}
+
+// allClouds returns every cloud the exporter may create resources in
+func allClouds() []*cloudConfig {
+	var clouds []*cloudConfig
+
+	if defaultCloud.Auth.AuthURL != "" {
+		clouds = append(clouds, defaultCloud)
+	}
+
+	byName := map[string]*cloudConfig{}
+
+	usedCloudsMutex.Lock()
+	for name, cloud := range usedClouds {
+		byName[name] = cloud
+	}
+	usedCloudsMutex.Unlock()
+
+	for name, cloud := range configuration.Clouds {
+		byName[name] = cloud
+	}
+
+	names := make([]string, 0, len(byName))
+
+	for name := range byName {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		clouds = append(clouds, byName[name])
+	}
+
+	return clouds
+}
+
+// authOptions returns the Keystone v3 authentication options of the cloud
+func (c *cloudConfig) authOptions() (*tokens.AuthOptions, error) {
+	authType := c.AuthType
+
+	// Guess the authentication method from the available credentials
+	if authType == "" {
+		switch {
+		case c.Auth.ApplicationCredentialID != "" || c.Auth.ApplicationCredentialName != "":
+			authType = "v3applicationcredential"
+		case c.Auth.Token != "" && c.Auth.Password == "":
+			authType = "v3token"
+		default:
+			authType = "password"
+		}
+	}
+
+	scope := tokens.Scope{
+		ProjectID:   c.Auth.ProjectID,
+		ProjectName: c.Auth.ProjectName,
+	}
+
+	// A project ID is enough to scope a token, its domain is only needed
+	// when the project is given by name
+	if c.Auth.ProjectID == "" {
+		scope.DomainName = c.Auth.ProjectDomainName
+		scope.DomainID = c.Auth.ProjectDomainID
+	}
+
+	switch authType {
+	case "v3applicationcredential":
+		// Application credentials are bound to a project, so they must not
+		// be scoped. The user is only needed to find one by name.
+		opts := &tokens.AuthOptions{
+			ApplicationCredentialID:     c.Auth.ApplicationCredentialID,
+			ApplicationCredentialName:   c.Auth.ApplicationCredentialName,
+			ApplicationCredentialSecret: c.Auth.ApplicationCredentialSecret,
+		}
+
+		if opts.ApplicationCredentialID == "" {
+			opts.UserID = c.Auth.UserID
+			opts.Username = c.Auth.Username
+			opts.DomainName = c.Auth.UserDomainName
+			opts.DomainID = c.Auth.UserDomainID
+		}
+
+		return opts, nil
+	case "v3token", "token":
+		return &tokens.AuthOptions{
+			TokenID: c.Auth.Token,
+			Scope:   scope,
+		}, nil
+	case "password", "v3password":
+		return &tokens.AuthOptions{
+			Username:   c.Auth.Username,
+			UserID:     c.Auth.UserID,
+			DomainName: c.Auth.UserDomainName,
+			DomainID:   c.Auth.UserDomainID,
+			Password:   c.Auth.Password,
+			Scope:      scope,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported auth_type %q", authType)
+	}
+}
+
+func (c *cloudConfig) endpointOpts() gophercloud.EndpointOpts {
+	return gophercloud.EndpointOpts{Region: c.RegionName}
+}
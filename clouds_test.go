@@ -0,0 +1,416 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+// setenv sets an environment variable for the duration of the test, an empty
+// value unsetting it
+func setenv(t *testing.T, name string, value string) {
+	previous, ok := os.LookupEnv(name)
+
+	if value == "" {
+		os.Unsetenv(name)
+	} else {
+		os.Setenv(name, value)
+	}
+
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+// cloudsTestDir isolates the test from the OpenStack settings of the host: it
+// unsets the OS_* variables and moves into a temporary home and working
+// directory, whose path is returned
+func cloudsTestDir(t *testing.T) string {
+	for _, variable := range os.Environ() {
+		if name := strings.SplitN(variable, "=", 2)[0]; strings.HasPrefix(name, "OS_") {
+			setenv(t, name, "")
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "clouds")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "work"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(filepath.Join(dir, "work")); err != nil {
+		t.Fatal(err)
+	}
+
+	setenv(t, "HOME", dir)
+
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	})
+
+	return dir
+}
+
+// writeFile writes content to path, creating its directory
+func writeFile(t *testing.T, path string, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindCloudsFile(t *testing.T) {
+	tests := []struct {
+		name string
+		// files are created relatively to the temporary home directory
+		files []string
+		env   string
+		want  string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:  "user directory",
+			files: []string{".config/openstack/clouds.yaml"},
+			want:  ".config/openstack/clouds.yaml",
+		},
+		{
+			name:  "working directory first",
+			files: []string{".config/openstack/clouds.yaml", "work/clouds.yaml"},
+			want:  "work/clouds.yaml",
+		},
+		{
+			name:  "environment variable first",
+			files: []string{".config/openstack/clouds.yaml", "work/clouds.yaml", "other.yaml"},
+			env:   "other.yaml",
+			want:  "other.yaml",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := cloudsTestDir(t)
+
+			for _, file := range test.files {
+				writeFile(t, filepath.Join(dir, file), "clouds: {}\n")
+			}
+
+			if test.env != "" {
+				setenv(t, "OS_CLIENT_CONFIG_FILE", filepath.Join(dir, test.env))
+			}
+
+			got := findCloudsFile("OS_CLIENT_CONFIG_FILE", "clouds.yaml")
+			want := test.want
+
+			if want != "" {
+				want = filepath.Join(dir, want)
+			}
+
+			// The working directory is returned relatively
+			if !filepath.IsAbs(got) && got != "" {
+				got = filepath.Join(dir, "work", got)
+			}
+
+			if got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestMergeYAML(t *testing.T) {
+	dst := map[interface{}]interface{}{
+		"clouds": map[interface{}]interface{}{
+			"region1": map[interface{}]interface{}{
+				"auth":        map[interface{}]interface{}{"username": "monitoring", "password": "old"},
+				"region_name": "RegionOne",
+			},
+		},
+	}
+
+	src := map[interface{}]interface{}{
+		"clouds": map[interface{}]interface{}{
+			"region1": map[interface{}]interface{}{
+				"auth": map[interface{}]interface{}{"password": "secret"},
+			},
+			"region2": map[interface{}]interface{}{"region_name": "RegionTwo"},
+		},
+	}
+
+	mergeYAML(dst, src)
+
+	want := map[interface{}]interface{}{
+		"clouds": map[interface{}]interface{}{
+			"region1": map[interface{}]interface{}{
+				"auth":        map[interface{}]interface{}{"username": "monitoring", "password": "secret"},
+				"region_name": "RegionOne",
+			},
+			"region2": map[interface{}]interface{}{"region_name": "RegionTwo"},
+		},
+	}
+
+	if !reflect.DeepEqual(dst, want) {
+		t.Errorf("got %v, want %v", dst, want)
+	}
+}
+
+func TestEnvCloud(t *testing.T) {
+	const cloudsYAML = `
+clouds:
+  region1:
+    auth:
+      auth_url: https://keystone.region1.example.com/v3
+      username: monitoring
+      project_name: monitoring
+    region_name: RegionOne
+`
+	const secureYAML = `
+clouds:
+  region1:
+    auth:
+      password: secret
+`
+
+	tests := []struct {
+		name   string
+		env    map[string]string
+		secure bool
+		want   func(c *cloudConfig)
+		err    bool
+	}{
+		{
+			name: "environment only",
+			env:  map[string]string{"OS_AUTH_URL": "https://keystone.example.com/v3", "OS_USERNAME": "admin", "OS_PASSWORD": "password"},
+			want: func(c *cloudConfig) {
+				c.Auth.AuthURL = "https://keystone.example.com/v3"
+				c.Auth.Username = "admin"
+				c.Auth.Password = "password"
+			},
+		},
+		{
+			name:   "clouds.yaml with secure.yaml",
+			env:    map[string]string{"OS_CLOUD": "region1"},
+			secure: true,
+			want: func(c *cloudConfig) {
+				c.Auth.AuthURL = "https://keystone.region1.example.com/v3"
+				c.Auth.Username = "monitoring"
+				c.Auth.Password = "secret"
+				c.Auth.ProjectName = "monitoring"
+				c.RegionName = "RegionOne"
+			},
+		},
+		{
+			name:   "environment over clouds.yaml",
+			env:    map[string]string{"OS_CLOUD": "region1", "OS_PASSWORD": "other", "OS_REGION_NAME": "RegionTwo", "OS_PROJECT_ID": "project-1"},
+			secure: true,
+			want: func(c *cloudConfig) {
+				c.Auth.AuthURL = "https://keystone.region1.example.com/v3"
+				c.Auth.Username = "monitoring"
+				c.Auth.Password = "other"
+				c.Auth.ProjectName = "monitoring"
+				c.Auth.ProjectID = "project-1"
+				c.RegionName = "RegionTwo"
+			},
+		},
+		{
+			name: "unknown cloud",
+			env:  map[string]string{"OS_CLOUD": "region2"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := cloudsTestDir(t)
+			writeFile(t, filepath.Join(dir, ".config", "openstack", "clouds.yaml"), cloudsYAML)
+
+			if test.secure {
+				writeFile(t, filepath.Join(dir, "work", "secure.yaml"), secureYAML)
+			}
+
+			for name, value := range test.env {
+				setenv(t, name, value)
+			}
+
+			cloud, err := envCloud()
+
+			if test.err {
+				if err == nil {
+					t.Errorf("got %+v, want an error", cloud)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := &cloudConfig{}
+			test.want(want)
+
+			if !reflect.DeepEqual(cloud, want) {
+				t.Errorf("got %+v, want %+v", cloud, want)
+			}
+		})
+	}
+}
+
+func TestAuthOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		cloud func(c *cloudConfig)
+		want  tokens.AuthOptions
+		err   bool
+	}{
+		{
+			name: "password scoped by project name",
+			cloud: func(c *cloudConfig) {
+				c.Auth.Username = "monitoring"
+				c.Auth.Password = "secret"
+				c.Auth.UserDomainName = "Default"
+				c.Auth.ProjectName = "monitoring"
+				c.Auth.ProjectDomainName = "Default"
+			},
+			want: tokens.AuthOptions{
+				Username:   "monitoring",
+				Password:   "secret",
+				DomainName: "Default",
+				Scope:      tokens.Scope{ProjectName: "monitoring", DomainName: "Default"},
+			},
+		},
+		{
+			name: "password scoped by project ID",
+			cloud: func(c *cloudConfig) {
+				c.Auth.UserID = "user-1"
+				c.Auth.Password = "secret"
+				c.Auth.ProjectID = "project-1"
+				c.Auth.ProjectDomainName = "Default"
+			},
+			want: tokens.AuthOptions{
+				UserID:   "user-1",
+				Password: "secret",
+				Scope:    tokens.Scope{ProjectID: "project-1"},
+			},
+		},
+		{
+			name: "application credential by ID",
+			cloud: func(c *cloudConfig) {
+				c.Auth.Username = "monitoring"
+				c.Auth.ApplicationCredentialID = "credential-1"
+				c.Auth.ApplicationCredentialSecret = "secret"
+				c.Auth.ProjectID = "project-1"
+			},
+			want: tokens.AuthOptions{
+				ApplicationCredentialID:     "credential-1",
+				ApplicationCredentialSecret: "secret",
+			},
+		},
+		{
+			name: "application credential by name",
+			cloud: func(c *cloudConfig) {
+				c.Auth.Username = "monitoring"
+				c.Auth.UserDomainName = "Default"
+				c.Auth.ApplicationCredentialName = "exporter"
+				c.Auth.ApplicationCredentialSecret = "secret"
+			},
+			want: tokens.AuthOptions{
+				Username:                    "monitoring",
+				DomainName:                  "Default",
+				ApplicationCredentialName:   "exporter",
+				ApplicationCredentialSecret: "secret",
+			},
+		},
+		{
+			name: "token",
+			cloud: func(c *cloudConfig) {
+				c.Auth.Token = "token-1"
+				c.Auth.ProjectID = "project-1"
+			},
+			want: tokens.AuthOptions{
+				TokenID: "token-1",
+				Scope:   tokens.Scope{ProjectID: "project-1"},
+			},
+		},
+		{
+			name: "password preferred over token",
+			cloud: func(c *cloudConfig) {
+				c.Auth.Username = "monitoring"
+				c.Auth.Password = "secret"
+				c.Auth.Token = "token-1"
+			},
+			want: tokens.AuthOptions{
+				Username: "monitoring",
+				Password: "secret",
+			},
+		},
+		{
+			name: "explicit auth type",
+			cloud: func(c *cloudConfig) {
+				c.AuthType = "v3token"
+				c.Auth.Username = "monitoring"
+				c.Auth.Password = "secret"
+				c.Auth.Token = "token-1"
+			},
+			want: tokens.AuthOptions{
+				TokenID: "token-1",
+			},
+		},
+		{
+			name: "unsupported auth type",
+			cloud: func(c *cloudConfig) {
+				c.AuthType = "v2password"
+			},
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloud := &cloudConfig{}
+			test.cloud(cloud)
+
+			opts, err := cloud.authOptions()
+
+			if test.err {
+				if err == nil {
+					t.Errorf("got %+v, want an error", opts)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(*opts, test.want) {
+				t.Errorf("got %+v, want %+v", *opts, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ssh"
+)
+
+// commandCheck is a command run in the instance once it is reachable over SSH
+type commandCheck struct {
+	// Name is the value of the command label of the metrics
+	Name    string `yaml:"name"`
+	Command string `yaml:"command"`
+	// ExitCode is the expected exit code of the command
+	ExitCode int `yaml:"exit_code"`
+	// Stdout is a regular expression the output of the command must match
+	Stdout string `yaml:"stdout"`
+
+	stdout *regexp.Regexp
+}
+
+// compile checks the settings of the command and compiles its regular expression
+func (c *commandCheck) compile() error {
+	if c.Name == "" || c.Command == "" {
+		return fmt.Errorf("commands need a name and a command")
+	}
+
+	re, err := regexp.Compile(c.Stdout)
+
+	if err != nil {
+		return fmt.Errorf("command %s: invalid stdout regular expression: %s", c.Name, err)
+	}
+
+	c.stdout = re
+
+	return nil
+}
+
+// runCommands runs the commands of the module over a single SSH connection to
+// address and exports the outcome of each one, it fails if any command fails
+func runCommands(ctx context.Context, r *probeRun, address string, config *ssh.ClientConfig) error {
+	namespace := program + "_" + r.module.Prober
+
+	success := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "command_success",
+		Help:        "'1' if the command ran in the instance with the expected exit code and output",
+		ConstLabels: r.labels,
+	},
+		[]string{"command"},
+	)
+
+	exitCode := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "command_exit_code",
+		Help:        "Exit code of the command run in the instance",
+		ConstLabels: r.labels,
+	},
+		[]string{"command"},
+	)
+
+	duration := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "command_duration_seconds",
+		Help:        "Duration of the command run in the instance",
+		ConstLabels: r.labels,
+	},
+		[]string{"command"},
+	)
+
+	r.registry.MustRegister(success)
+	r.registry.MustRegister(exitCode)
+	r.registry.MustRegister(duration)
+
+	client, err := sshDial(ctx, address, config)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	var failed []string
+
+	for _, c := range r.module.Commands {
+		start := time.Now()
+		stdout, code, err := runCommand(client, c.Command)
+		duration.WithLabelValues(c.Name).Set(time.Since(start).Seconds())
+
+		if ctx.Err() != nil {
+			return withReason(reasonTimeout, fmt.Errorf("timeout while running command %s", c.Name))
+		}
+
+		switch {
+		case err != nil:
+			log.Printf("command %s failed: %s", c.Name, err)
+		case code != c.ExitCode:
+			log.Printf("command %s exited with code %d instead of %d, output: %q", c.Name, code, c.ExitCode, stdout)
+		case !c.stdout.MatchString(stdout):
+			log.Printf("command %s output does not match %q: %q", c.Name, c.Stdout, stdout)
+		default:
+			success.WithLabelValues(c.Name).Set(1)
+			exitCode.WithLabelValues(c.Name).Set(float64(code))
+			continue
+		}
+
+		if err == nil {
+			exitCode.WithLabelValues(c.Name).Set(float64(code))
+		}
+
+		success.WithLabelValues(c.Name).Set(0)
+		failed = append(failed, c.Name)
+	}
+
+	if len(failed) > 0 {
+		return withReason(reasonCommandFailed, fmt.Errorf("commands failed: %s", strings.Join(failed, ", ")))
+	}
+
+	return nil
+}
+
+// sshDial connects to address, the connection being closed when ctx is done
+// to interrupt the running command on timeout
+func sshDial(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	client, err := sshDialer("tcp", address, config)
+
+	if err != nil {
+		return nil, withReason(sshReason(err), fmt.Errorf("failed to dial: %w", err))
+	}
+
+	go func() {
+		<-ctx.Done()
+		client.Close()
+	}()
+
+	return client, nil
+}
+
+// runCommand runs command in a new session of client and returns its output
+// and exit code
+func runCommand(client *ssh.Client, command string) (string, int, error) {
+	session, err := client.NewSession()
+
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	defer session.Close()
+
+	var stdout bytes.Buffer
+	session.Stdout = &stdout
+
+	err = session.Run(command)
+
+	var exitError *ssh.ExitError
+
+	if errors.As(err, &exitError) {
+		return stdout.String(), exitError.ExitStatus(), nil
+	}
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	return stdout.String(), 0, nil
+}
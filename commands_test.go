@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSpawnCommands(t *testing.T) {
+	f, s, module := newSpawnFixture(t, "spawn")
+
+	s.exec = func(command string) (string, uint32) {
+		switch command {
+		case "/usr/bin/whoami":
+			return "ubuntu\n", 0
+		case "getent hosts mirror.example.com":
+			return "10.0.0.5 mirror.example.com\n", 0
+		case "curl -s http://mirror.example.com/":
+			return "", 7
+		default:
+			return "", 127
+		}
+	}
+
+	module.Commands = []*commandCheck{
+		{Name: "dns", Command: "getent hosts mirror.example.com", Stdout: `^10\.0\.`},
+		{Name: "mirror", Command: "curl -s http://mirror.example.com/"},
+		{Name: "unexpected_output", Command: "/usr/bin/whoami", Stdout: "^root$"},
+		{Name: "expected_failure", Command: "curl -s http://mirror.example.com/", ExitCode: 7},
+	}
+
+	if err := module.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runTestProbe(t, module, f.cloud())
+
+	if result.success || result.reason != reasonCommandFailed || result.step != "ssh_successful" {
+		t.Errorf("got %+v, want failure with reason %s after step ssh_successful", result, reasonCommandFailed)
+	}
+
+	tests := []struct {
+		command  string
+		success  float64
+		exitCode float64
+	}{
+		{command: "dns", success: 1, exitCode: 0},
+		{command: "mirror", success: 0, exitCode: 7},
+		{command: "unexpected_output", success: 0, exitCode: 0},
+		{command: "expected_failure", success: 1, exitCode: 7},
+	}
+
+	for _, test := range tests {
+		labels := map[string]string{"command": test.command}
+
+		if value, ok := result.value(t, "openstack_client_spawn_command_success", labels); !ok || value != test.success {
+			t.Errorf("command %s: got success %v, want %v", test.command, value, test.success)
+		}
+
+		if value, ok := result.value(t, "openstack_client_spawn_command_exit_code", labels); !ok || value != test.exitCode {
+			t.Errorf("command %s: got exit code %v, want %v", test.command, value, test.exitCode)
+		}
+
+		if _, ok := result.value(t, "openstack_client_spawn_command_duration_seconds", labels); !ok {
+			t.Errorf("command %s: no duration", test.command)
+		}
+	}
+}
+
+func TestCommandValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []*commandCheck
+	}{
+		{name: "missing command", commands: []*commandCheck{{Name: "dns"}}},
+		{name: "invalid regular expression", commands: []*commandCheck{{Name: "dns", Command: "true", Stdout: "("}}},
+		{name: "duplicate name", commands: []*commandCheck{{Name: "dns", Command: "true"}, {Name: "dns", Command: "false"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			module := testModule("spawn")
+			module.Commands = test.commands
+
+			if err := module.validate(); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
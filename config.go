@@ -0,0 +1,416 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// config is the content of the file given with -config
+type config struct {
+	Clouds  map[string]*cloudConfig  `yaml:"clouds"`
+	Modules map[string]*moduleConfig `yaml:"modules"`
+}
+
+// cloudConfig describes how to reach an OpenStack cloud, its layout follows
+// the one of the clouds.yaml file used by the OpenStack command line clients
+type cloudConfig struct {
+	// name is the key of the cloud in the configuration or clouds.yaml file,
+	// empty for the cloud described by OS_CLOUD and the OS_* environment variables
+	name string
+
+	Auth struct {
+		AuthURL                     string `yaml:"auth_url"`
+		Username                    string `yaml:"username"`
+		UserID                      string `yaml:"user_id"`
+		Password                    string `yaml:"password"`
+		UserDomainName              string `yaml:"user_domain_name"`
+		UserDomainID                string `yaml:"user_domain_id"`
+		ProjectName                 string `yaml:"project_name"`
+		ProjectID                   string `yaml:"project_id"`
+		ProjectDomainName           string `yaml:"project_domain_name"`
+		ProjectDomainID             string `yaml:"project_domain_id"`
+		ApplicationCredentialID     string `yaml:"application_credential_id"`
+		ApplicationCredentialName   string `yaml:"application_credential_name"`
+		ApplicationCredentialSecret string `yaml:"application_credential_secret"`
+		Token                       string `yaml:"token"`
+	} `yaml:"auth"`
+
+	// AuthType selects the authentication method, it is guessed from the
+	// available credentials when empty
+	AuthType string `yaml:"auth_type"`
+
+	RegionName string `yaml:"region_name"`
+}
+
+// ignoredCloudSettings are the settings of clouds.yaml the exporter does not
+// use but that are safe to ignore
+var ignoredCloudSettings = []string{
+	"interface",
+	"identity_interface",
+	"identity_api_version",
+	"compute_api_version",
+	"image_api_version",
+	"network_api_version",
+	"volume_api_version",
+	"display_name",
+}
+
+// unsupportedCloudSettings are the TLS settings of clouds.yaml the exporter
+// does not support, rejected rather than silently ignored
+var unsupportedCloudSettings = []string{"verify", "cacert", "cert", "key"}
+
+// UnmarshalYAML decodes a cloud strictly, apart from the settings of
+// clouds.yaml the exporter ignores
+func (c *cloudConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	values := map[interface{}]interface{}{}
+
+	if err := unmarshal(&values); err != nil {
+		return err
+	}
+
+	for _, name := range unsupportedCloudSettings {
+		if _, ok := values[name]; ok {
+			return fmt.Errorf("%s is not supported, TLS certificates are verified against the trusted authorities of the system", name)
+		}
+	}
+
+	for _, name := range ignoredCloudSettings {
+		delete(values, name)
+	}
+
+	content, err := yaml.Marshal(values)
+
+	if err != nil {
+		return err
+	}
+
+	type plainCloudConfig cloudConfig
+
+	return yaml.UnmarshalStrict(content, (*plainCloudConfig)(c))
+}
+
+// moduleConfig holds the settings of a probe, several modules may use the same
+// prober with different settings. Unset settings default to the command line flags.
+type moduleConfig struct {
+	// name is the key of the module in the configuration file, or the name of
+	// the prober for the modules built from the command line flags
+	name string
+
+	Prober string `yaml:"prober"`
+	// Interval is the time between two runs of the probe, 0 running it on
+	// scrape, or the interval of the prober when unset
+	Interval *time.Duration `yaml:"interval"`
+	Timeout  time.Duration  `yaml:"timeout"`
+
+	// Spawn settings
+	Image           string `yaml:"image"`
+	Flavor          string `yaml:"flavor"`
+	InternalNetwork string `yaml:"internal_network"`
+	ExternalNetwork string `yaml:"external_network"`
+	User            string `yaml:"user"`
+	SSHPort         int    `yaml:"ssh_port"`
+	VolumeSize      int    `yaml:"volume_size"`
+	// VolumeAvailabilityZone is the Cinder zone of the volumes created by
+	// the probes, the zone of the run or else the default zone of Cinder
+	// when empty
+	VolumeAvailabilityZone string `yaml:"volume_availability_zone"`
+	// BootMode is one of volume, image or image_volume
+	BootMode string `yaml:"boot_mode"`
+	// AddressFamily is ipv4 or ipv6, results are labelled with it when set
+	AddressFamily string `yaml:"address_family"`
+	// Commands are run in the instance once it is reachable over SSH
+	Commands []*commandCheck `yaml:"commands"`
+	// Metadata enables the check of the metadata read by the instance,
+	// ConfigDrive boots the instance with a config drive checked as well
+	Metadata    bool `yaml:"metadata"`
+	ConfigDrive bool `yaml:"config_drive"`
+	// UserData boots the instance with a user-data script whose execution is
+	// checked on the console and over SSH
+	UserData bool `yaml:"user_data"`
+	// VolumeAttach attaches an extra volume to the instance and writes to it
+	VolumeAttach bool `yaml:"volume_attach"`
+	// Lifecycle reboots, stops and starts the instance, and resizes it to
+	// ResizeFlavor when set
+	Lifecycle    bool   `yaml:"lifecycle"`
+	ResizeFlavor string `yaml:"resize_flavor"`
+	// AvailabilityZones runs the probe in each of the zones, or in each of
+	// the available zones of the cloud with DiscoverAvailabilityZones
+	AvailabilityZones         []string `yaml:"availability_zones"`
+	DiscoverAvailabilityZones bool     `yaml:"discover_availability_zones"`
+	// availabilityZone is the zone of a run, set on the copies of the module
+	// made for each zone
+	availabilityZone string
+	// Images and Flavors run the probe with each combination of image and
+	// flavor, Concurrency is the number of variants of the module run by each
+	// run in rotation, all of them being run at once when 0
+	Images      []string `yaml:"images"`
+	Flavors     []string `yaml:"flavors"`
+	Concurrency int      `yaml:"concurrency"`
+
+	// Image validation settings, images whose name matches ImagePattern and
+	// which have all of ImageProperties are booted once, LatestImage only
+	// considers the newest of them and ValidateExistingImages the ones
+	// created before the exporter started as well
+	ImagePattern           string            `yaml:"image_pattern"`
+	ImageProperties        map[string]string `yaml:"image_properties"`
+	LatestImage            bool              `yaml:"latest_image"`
+	ValidateExistingImages bool              `yaml:"validate_existing_images"`
+
+	// ServerGroupPolicy is the policy of the server group of the probes
+	// booting several instances, anti-affinity or soft-anti-affinity
+	ServerGroupPolicy string `yaml:"server_group_policy"`
+
+	// East-west settings
+	PingCount int `yaml:"ping_count"`
+
+	// Object store settings
+	ObjectSize int64 `yaml:"object_size"`
+}
+
+var configuration = &config{}
+
+func loadConfig(path string) (*config, error) {
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot read configuration file: %s", err)
+	}
+
+	c := &config{}
+
+	if err := yaml.UnmarshalStrict(content, c); err != nil {
+		return nil, fmt.Errorf("cannot parse configuration file %s: %s", path, err)
+	}
+
+	for name, cloud := range c.Clouds {
+		if cloud == nil {
+			return nil, fmt.Errorf("cloud %s has no settings", name)
+		}
+
+		cloud.name = name
+	}
+
+	for name, module := range c.Modules {
+		if module == nil {
+			return nil, fmt.Errorf("module %s has no settings", name)
+		}
+
+		if _, ok := registeredProbes[module.Prober]; !ok {
+			return nil, fmt.Errorf("module %s: unknown prober %q, available probers are %s", name, module.Prober, strings.Join(probeNames(), ","))
+		}
+
+		module.name = name
+		module.setDefaults()
+
+		if err := module.validate(); err != nil {
+			return nil, fmt.Errorf("module %s: %s", name, err)
+		}
+	}
+
+	return c, nil
+}
+
+// defaultModule returns the module running prober with the command line settings
+func defaultModule(prober string) *moduleConfig {
+	module := &moduleConfig{
+		name:   prober,
+		Prober: prober,
+	}
+
+	module.setDefaults()
+
+	return module
+}
+
+func (m *moduleConfig) setDefaults() {
+	if m.Interval == nil {
+		interval := registeredProbes[m.Prober].interval
+		m.Interval = &interval
+	}
+
+	if m.Timeout == 0 {
+		m.Timeout = requestTimeout
+	}
+
+	if m.Image == "" {
+		m.Image = imageName
+	}
+
+	if m.Flavor == "" {
+		m.Flavor = flavorName
+	}
+
+	if m.InternalNetwork == "" {
+		m.InternalNetwork = internalNetwork
+	}
+
+	if m.ExternalNetwork == "" {
+		m.ExternalNetwork = externalNetwork
+	}
+
+	if m.User == "" {
+		m.User = userName
+	}
+
+	if m.SSHPort == 0 {
+		m.SSHPort = defaultSSHPort
+	}
+
+	if m.VolumeSize == 0 {
+		m.VolumeSize = defaultVolumeSize
+	}
+
+	if m.BootMode == "" {
+		m.BootMode = bootModeVolume
+	}
+
+	if m.ServerGroupPolicy == "" {
+		m.ServerGroupPolicy = serverGroupPolicyAntiAffinity
+	}
+
+	if m.PingCount == 0 {
+		m.PingCount = defaultPingCount
+	}
+
+	if m.ObjectSize == 0 {
+		m.ObjectSize = defaultObjectSize
+	}
+}
+
+// validate checks the settings which have no default
+func (m *moduleConfig) validate() error {
+	if !contains(bootModes, m.BootMode) {
+		return fmt.Errorf("unknown boot mode %q, available boot modes are %s", m.BootMode, strings.Join(bootModes, ","))
+	}
+
+	if m.AddressFamily != "" && !contains(addressFamilies, m.AddressFamily) {
+		return fmt.Errorf("unknown address family %q, available address families are %s", m.AddressFamily, strings.Join(addressFamilies, ","))
+	}
+
+	if !contains(serverGroupPolicies, m.ServerGroupPolicy) {
+		return fmt.Errorf("unknown server group policy %q, available policies are %s", m.ServerGroupPolicy, strings.Join(serverGroupPolicies, ","))
+	}
+
+	if (m.DiscoverAvailabilityZones || len(m.AvailabilityZones) > 0) && m.Prober != "spawn" {
+		return fmt.Errorf("availability zones are only supported by the spawn prober")
+	}
+
+	if (len(m.Images) > 0 || len(m.Flavors) > 0) && m.Prober != "spawn" {
+		return fmt.Errorf("images and flavors are only supported by the spawn prober")
+	}
+
+	if m.Prober == "image_validation" {
+		if m.ImagePattern == "" && len(m.ImageProperties) == 0 {
+			return fmt.Errorf("image_pattern or image_properties must be set")
+		}
+
+		if _, err := regexp.Compile(m.ImagePattern); err != nil {
+			return fmt.Errorf("invalid image pattern: %s", err)
+		}
+	}
+
+	if m.Concurrency < 0 {
+		return fmt.Errorf("invalid concurrency %d", m.Concurrency)
+	}
+
+	names := map[string]bool{}
+
+	for _, c := range m.Commands {
+		if err := c.compile(); err != nil {
+			return err
+		}
+
+		if names[c.Name] {
+			return fmt.Errorf("command %s defined twice", c.Name)
+		}
+
+		names[c.Name] = true
+	}
+
+	return nil
+}
+
+// logName returns the name of the module along with the variant of the run,
+// if any
+func (m *moduleConfig) logName() string {
+	var values []string
+
+	for _, value := range m.variant() {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	if len(values) == 0 {
+		return m.name
+	}
+
+	return m.name + "@" + strings.Join(values, "/")
+}
+
+// getModule returns the module with the given name, modules of the
+// configuration file take precedence over the ones built from the flags
+func getModule(name string) (*moduleConfig, bool) {
+	if module, ok := configuration.Modules[name]; ok {
+		return module, true
+	}
+
+	if _, ok := registeredProbes[name]; ok {
+		return defaultModule(name), true
+	}
+
+	return nil, false
+}
+
+// getModules returns the modules listed in a comma separated list
+func getModules(list string) ([]*moduleConfig, error) {
+	var modules []*moduleConfig
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+
+		if name == "" {
+			continue
+		}
+
+		module, ok := getModule(name)
+
+		if !ok {
+			return nil, fmt.Errorf("unknown probe or module %s", name)
+		}
+
+		modules = append(modules, module)
+	}
+
+	return modules, nil
+}
+
+// contains tells whether list holds s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maxTimeout returns the longest timeout of all modules, resources older than
+// that are leftovers which can be garbage collected
+func maxTimeout() time.Duration {
+	timeout := requestTimeout
+
+	for _, module := range configuration.Modules {
+		if module.Timeout > timeout {
+			timeout = module.Timeout
+		}
+	}
+
+	return timeout
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// loadTestConfig loads a configuration file with the given content
+func loadTestConfig(t *testing.T, content string) (*config, error) {
+	dir, err := ioutil.TempDir("", "config")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "config.yaml")
+
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return loadConfig(path)
+}
+
+func TestLoadConfigClouds(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     bool
+	}{
+		{
+			name: "clouds.yaml settings",
+			content: `
+clouds:
+  region1:
+    auth:
+      auth_url: https://keystone.region1.example.com/v3
+      username: monitoring
+      password: secret
+      user_domain_name: Default
+      project_name: monitoring
+      project_domain_name: Default
+    region_name: RegionOne
+    interface: public
+    identity_api_version: 3
+`,
+		},
+		{
+			name: "cloud without settings",
+			content: `
+clouds:
+  region1:
+`,
+			err: true,
+		},
+		{
+			name: "misspelled auth setting",
+			content: `
+clouds:
+  region1:
+    auth:
+      auth_url: https://keystone.region1.example.com/v3
+      username: monitoring
+      pasword: secret
+    region_name: RegionOne
+`,
+			err: true,
+		},
+		{
+			name: "unknown cloud setting",
+			content: `
+clouds:
+  region1:
+    auth_ur: https://keystone.region1.example.com/v3
+    region_name: RegionOne
+`,
+			err: true,
+		},
+		{
+			name: "TLS setting",
+			content: `
+clouds:
+  region1:
+    auth:
+      auth_url: https://keystone.region1.example.com/v3
+      username: monitoring
+      password: secret
+    region_name: RegionOne
+    cacert: /etc/ssl/certs/region1.pem
+`,
+			err: true,
+		},
+		{
+			name: "unknown top-level key",
+			content: `
+cloud:
+  region1:
+    region_name: RegionOne
+`,
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := loadTestConfig(t, test.content)
+
+			if test.err {
+				if err == nil {
+					t.Errorf("got %+v, want an error", c)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cloud := c.Clouds["region1"]
+
+			if cloud.name != "region1" || cloud.RegionName != "RegionOne" || cloud.Auth.Password != "secret" {
+				t.Errorf("got %+v", cloud)
+			}
+		})
+	}
+}
+
+func TestLoadConfigModules(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		err      bool
+		interval time.Duration
+	}{
+		{
+			name: "valid",
+			content: `
+modules:
+  spawn_small:
+    prober: spawn
+    flavor: t2.small
+    boot_mode: image
+    timeout: 2m
+    commands:
+      - name: dns
+        command: getent hosts archive.ubuntu.com
+`,
+			interval: registeredProbes["spawn"].interval,
+		},
+		{
+			name: "run on scrape",
+			content: `
+modules:
+  spawn_small:
+    prober: spawn
+    flavor: t2.small
+    boot_mode: image
+    timeout: 2m
+    interval: 0
+`,
+			interval: 0,
+		},
+		{
+			name: "unknown prober",
+			content: `
+modules:
+  spawn_small:
+    prober: spawner
+`,
+			err: true,
+		},
+		{
+			name: "module without settings",
+			content: `
+modules:
+  spawn_small:
+`,
+			err: true,
+		},
+		{
+			name: "unknown setting",
+			content: `
+modules:
+  spawn_small:
+    prober: spawn
+    flavour: t2.small
+`,
+			err: true,
+		},
+		{
+			name: "unknown boot mode",
+			content: `
+modules:
+  spawn_small:
+    prober: spawn
+    boot_mode: network
+`,
+			err: true,
+		},
+		{
+			name: "unknown address family",
+			content: `
+modules:
+  spawn_small:
+    prober: spawn
+    address_family: ipx
+`,
+			err: true,
+		},
+		{
+			name: "unknown server group policy",
+			content: `
+modules:
+  east_west:
+    prober: east_west
+    server_group_policy: affinity
+`,
+			err: true,
+		},
+		{
+			name: "command defined twice",
+			content: `
+modules:
+  spawn_small:
+    prober: spawn
+    commands:
+      - name: dns
+        command: getent hosts archive.ubuntu.com
+      - name: dns
+        command: getent hosts example.com
+`,
+			err: true,
+		},
+		{
+			name: "invalid command pattern",
+			content: `
+modules:
+  spawn_small:
+    prober: spawn
+    commands:
+      - name: dns
+        command: getent hosts archive.ubuntu.com
+        stdout: "("
+`,
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := loadTestConfig(t, test.content)
+
+			if test.err {
+				if err == nil {
+					t.Errorf("got %+v, want an error", c)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			module := c.Modules["spawn_small"]
+
+			if module.name != "spawn_small" || module.Flavor != "t2.small" || module.BootMode != bootModeImage || module.Timeout.Minutes() != 2 {
+				t.Errorf("got %+v", module)
+			}
+
+			if module.Interval == nil || *module.Interval != test.interval {
+				t.Errorf("got interval %v, want %v", module.Interval, test.interval)
+			}
+
+			// Unset settings default to the command line flags
+			if module.Image != imageName || module.SSHPort != defaultSSHPort {
+				t.Errorf("got defaults %+v", module)
+			}
+		})
+	}
+}
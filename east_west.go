@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultPingCount = 5
+)
+
+var (
+	packetLossRegexp = regexp.MustCompile(`([0-9.]+)% packet loss`)
+	// Matches the summary of both iputils and busybox ping
+	rttRegexp = regexp.MustCompile(`= [0-9.]+/([0-9.]+)/`)
+)
+
+// parsePing returns the packet loss ratio and the average round trip time
+// from the output of ping, the round trip time is negative when no reply
+// was received
+func parsePing(output string) (float64, time.Duration, error) {
+	match := packetLossRegexp.FindStringSubmatch(output)
+
+	if len(match) != 2 {
+		return 0, 0, fmt.Errorf("cannot find packet loss in ping output %q", output)
+	}
+
+	loss, err := strconv.ParseFloat(match[1], 64)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot parse packet loss: %w", err)
+	}
+
+	match = rttRegexp.FindStringSubmatch(output)
+
+	if len(match) != 2 {
+		return loss / 100, -1, nil
+	}
+
+	rtt, err := strconv.ParseFloat(match[1], 64)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot parse round trip time: %w", err)
+	}
+
+	return loss / 100, time.Duration(rtt * float64(time.Millisecond)), nil
+}
+
+func eastWest(ctx context.Context, r *probeRun) error {
+	if err := r.step(ctx, "start"); err != nil {
+		return err
+	}
+
+	resourceName := createName()
+	log.Printf("eastWest using resource name %s\n", resourceName)
+
+	provider, err := getProvider(ctx, r.cloud)
+
+	if err != nil {
+		return err
+	}
+
+	if err := r.step(ctx, "auth_ok"); err != nil {
+		return err
+	}
+
+	// Boot two servers on different hypervisors, so that their traffic goes
+	// through the overlay network, allowing ICMP between them over the
+	// address family of the module
+
+	protocol := rules.ProtocolICMP
+
+	if r.module.AddressFamily == addressFamilyIPv6 {
+		protocol = rules.ProtocolIPv6ICMP
+	}
+
+	g, err := bootInstances(ctx, r, provider, resourceName, []string{"a", "b"}, func(securityGroupID string) []rules.CreateOpts {
+		return []rules.CreateOpts{
+			{
+				Direction:     "ingress",
+				EtherType:     r.module.etherType(),
+				Protocol:      protocol,
+				RemoteGroupID: securityGroupID,
+				SecGroupID:    securityGroupID,
+			},
+		}
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Ping each server from the other one on its private address
+
+	if err := pingInstances(ctx, r, g); err != nil {
+		return err
+	}
+
+	if err := r.step(ctx, "ping_done"); err != nil {
+		return err
+	}
+
+	if err := r.step(ctx, "end"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// pingInstances pings each instance from the other ones and exports the packet
+// loss and round trip time of each direction, it fails if any direction lost
+// all packets
+func pingInstances(ctx context.Context, r *probeRun, g *instanceGroup) error {
+	namespace := program + "_" + r.module.Prober
+
+	packetLoss := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "packet_loss_ratio",
+		Help:        "Ratio of the packets lost between the private addresses of the servers",
+		ConstLabels: r.labels,
+	},
+		[]string{"source", "destination"},
+	)
+
+	rtt := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "rtt_seconds",
+		Help:        "Average round trip time between the private addresses of the servers",
+		ConstLabels: r.labels,
+	},
+		[]string{"source", "destination"},
+	)
+
+	r.registry.MustRegister(packetLoss)
+	r.registry.MustRegister(rtt)
+
+	var unreachable []string
+
+	for _, source := range g.instances {
+		client, err := g.dial(ctx, r, source)
+
+		if err != nil {
+			return err
+		}
+
+		defer client.Close()
+
+		for _, destination := range g.instances {
+			if destination == source {
+				continue
+			}
+
+			command := fmt.Sprintf("ping -c %d -W 2 %s", r.module.PingCount, destination.privateIP)
+			output, _, err := runCommand(client, command)
+
+			if ctx.Err() != nil {
+				return withReason(reasonTimeout, fmt.Errorf("timeout while pinging %s from %s", destination.name, source.name))
+			}
+
+			if err != nil {
+				return fmt.Errorf("ping from %s failed: %w", source.name, err)
+			}
+
+			loss, duration, err := parsePing(output)
+
+			if err != nil {
+				return err
+			}
+
+			log.Printf("ping from %s to %s: %.0f%% packet loss, %s rtt", source.name, destination.name, loss*100, duration)
+
+			packetLoss.WithLabelValues(source.name, destination.name).Set(loss)
+
+			if duration >= 0 {
+				rtt.WithLabelValues(source.name, destination.name).Set(duration.Seconds())
+			}
+
+			if loss == 1 {
+				unreachable = append(unreachable, source.name+" -> "+destination.name)
+			}
+		}
+	}
+
+	if len(unreachable) > 0 {
+		return withReason(reasonPacketLoss, fmt.Errorf("no reply received: %s", strings.Join(unreachable, ", ")))
+	}
+
+	return nil
+}
+
+type eastWestProbe struct{}
+
+func init() {
+	registerProbe(eastWestProbe{}, 10*time.Minute, false)
+}
+
+func (eastWestProbe) Name() string {
+	return "east_west"
+}
+
+func (eastWestProbe) Description() probeDescription {
+	return probeDescription{
+		success: "'1' when two OpenStack instances booted on different hypervisors successfully pinged each other on the internal network",
+		timing:  "Timestamp of each step for booting two OpenStack instances and pinging each other",
+	}
+}
+
+func (eastWestProbe) Run(ctx context.Context, r *probeRun) error {
+	return eastWest(ctx, r)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePing(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		loss   float64
+		rtt    time.Duration
+		err    bool
+	}{
+		{
+			name:   "iputils",
+			output: "5 packets transmitted, 4 received, 20% packet loss, time 4005ms\nrtt min/avg/max/mdev = 0.412/0.634/0.801/0.100 ms\n",
+			loss:   0.2,
+			rtt:    634 * time.Microsecond,
+		},
+		{
+			name:   "busybox",
+			output: "5 packets transmitted, 5 packets received, 0% packet loss\nround-trip min/avg/max = 0.512/1.500/2.801 ms\n",
+			loss:   0,
+			rtt:    1500 * time.Microsecond,
+		},
+		{
+			name:   "no reply",
+			output: "5 packets transmitted, 0 received, 100% packet loss, time 4099ms\n",
+			loss:   1,
+			rtt:    -1,
+		},
+		{
+			name:   "not a ping output",
+			output: "ping: command not found\n",
+			err:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loss, rtt, err := parsePing(test.output)
+
+			switch {
+			case test.err && err == nil:
+				t.Error("got no error")
+			case !test.err && err != nil:
+				t.Errorf("got error %s", err)
+			case !test.err && (loss != test.loss || rtt != test.rtt):
+				t.Errorf("got loss %v and rtt %s, want %v and %s", loss, rtt, test.loss, test.rtt)
+			}
+		})
+	}
+}
+
+func TestEastWest(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		success bool
+		loss    float64
+	}{
+		{
+			name:    "reachable",
+			output:  "5 packets transmitted, 5 received, 0% packet loss, time 4005ms\nrtt min/avg/max/mdev = 0.412/0.634/0.801/0.100 ms\n",
+			success: true,
+			loss:    0,
+		},
+		{
+			name:   "unreachable",
+			output: "5 packets transmitted, 0 received, 100% packet loss, time 4099ms\n",
+			loss:   1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, s, module := newSpawnFixture(t, "east_west")
+
+			var pinged []string
+
+			s.exec = func(command string) (string, uint32) {
+				if command == "/usr/bin/whoami" {
+					return "ubuntu\n", 0
+				}
+
+				if strings.HasPrefix(command, "ping -c 5 ") {
+					s.mutex.Lock()
+					pinged = append(pinged, strings.Fields(command)[len(strings.Fields(command))-1])
+					s.mutex.Unlock()
+
+					return test.output, 0
+				}
+
+				return "", 127
+			}
+
+			result := runTestProbe(t, module, f.cloud())
+
+			switch {
+			case test.success && !result.success:
+				t.Fatalf("got %+v, want success", result)
+			case !test.success && (result.success || result.reason != reasonPacketLoss || result.step != "ssh_successful"):
+				t.Fatalf("got %+v, want failure with reason %s after step ssh_successful", result, reasonPacketLoss)
+			}
+
+			for _, direction := range [][2]string{{"a", "b"}, {"b", "a"}} {
+				labels := map[string]string{"source": direction[0], "destination": direction[1]}
+
+				if value, ok := result.value(t, "openstack_client_east_west_packet_loss_ratio", labels); !ok || value != test.loss {
+					t.Errorf("%s to %s: got packet loss %v, want %v", direction[0], direction[1], value, test.loss)
+				}
+
+				if _, ok := result.value(t, "openstack_client_east_west_rtt_seconds", labels); ok != test.success {
+					t.Errorf("%s to %s: round trip time exported: %v", direction[0], direction[1], ok)
+				}
+			}
+
+			if len(pinged) != 2 || pinged[0] == pinged[1] {
+				t.Errorf("got pinged addresses %v, want the addresses of both servers", pinged)
+			}
+
+			if len(f.servers.objects) != 2 || len(f.serverGroups.objects) != 1 {
+				t.Errorf("got %d servers and %d server groups, want 2 and 1", len(f.servers.objects), len(f.serverGroups.objects))
+			}
+
+			if policies := f.serverGroups.list()[0]["policies"]; len(policies.([]interface{})) != 1 || policies.([]interface{})[0] != "anti-affinity" {
+				t.Errorf("got server group policies %v, want anti-affinity", policies)
+			}
+
+			icmp := false
+
+			for _, rule := range f.rules.list() {
+				if rule["protocol"] == "icmp" && rule["remote_group_id"] != nil {
+					icmp = true
+				}
+			}
+
+			if !icmp {
+				t.Errorf("ICMP between the servers not allowed: %v", f.rules.list())
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// Reasons are the bounded set of values of the reason label, the raw error
+// messages are only logged and served on /debug/errors
+const (
+	reasonAuth            = "auth"
+	reasonForbidden       = "forbidden"
+	reasonQuotaExceeded   = "quota_exceeded"
+	reasonNotFound        = "not_found"
+	reasonConflict        = "conflict"
+	reasonBadRequest      = "bad_request"
+	reasonAPI4xx          = "api_4xx"
+	reasonAPI5xx          = "api_5xx"
+	reasonAPIUnreachable  = "api_unreachable"
+	reasonNoEndpoint      = "endpoint_not_found"
+	reasonResourceError   = "resource_error"
+	reasonTimeout         = "timeout"
+	reasonSSHAuth         = "ssh_auth"
+	reasonHostKeyMismatch = "host_key_mismatch"
+	reasonSSHConnection   = "ssh_connection"
+	reasonCommandFailed   = "command_failed"
+	reasonMetadata        = "metadata_error"
+	reasonPacketLoss      = "packet_loss"
+	reasonDataCorruption  = "data_corruption"
+	reasonUserData        = "user_data_error"
+	reasonUnknown         = "unknown"
+)
+
+// probeError attaches a reason to an error whose type does not tell it
+type probeError struct {
+	reason string
+	err    error
+}
+
+func (e *probeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *probeError) Unwrap() error {
+	return e.err
+}
+
+func withReason(reason string, err error) error {
+	return &probeError{reason: reason, err: err}
+}
+
+// classifyError returns the reason why a probe failed, ctx being the context
+// of the run so that any error happening after its deadline is a timeout
+func classifyError(ctx context.Context, err error) string {
+	// Errors whose reason is known where they happen
+	var pe *probeError
+
+	if errors.As(err, &pe) {
+		return pe.reason
+	}
+
+	// Errors returned by the OpenStack APIs
+	if quotaExceeded(err) {
+		return reasonQuotaExceeded
+	}
+
+	var unexpected gophercloud.ErrUnexpectedResponseCode
+
+	switch {
+	case errors.As(err, &gophercloud.ErrDefault401{}):
+		return reasonAuth
+	case errors.As(err, &gophercloud.ErrDefault403{}):
+		return reasonForbidden
+	case errors.As(err, &gophercloud.ErrDefault404{}), errors.As(err, &gophercloud.ErrResourceNotFound{}):
+		return reasonNotFound
+	case errors.As(err, &gophercloud.ErrDefault409{}):
+		return reasonConflict
+	case errors.As(err, &gophercloud.ErrDefault400{}):
+		return reasonBadRequest
+	case errors.As(err, &gophercloud.ErrDefault405{}), errors.As(err, &gophercloud.ErrDefault408{}), errors.As(err, &gophercloud.ErrDefault429{}):
+		return reasonAPI4xx
+	case errors.As(err, &gophercloud.ErrDefault500{}), errors.As(err, &gophercloud.ErrDefault503{}):
+		return reasonAPI5xx
+	case errors.As(err, &gophercloud.ErrServiceNotFound{}), errors.As(err, &gophercloud.ErrEndpointNotFound{}):
+		return reasonNoEndpoint
+	case errors.As(err, &unexpected):
+		switch {
+		case unexpected.Actual == http.StatusConflict:
+			return reasonConflict
+		case unexpected.Actual >= 500:
+			return reasonAPI5xx
+		case unexpected.Actual >= 400:
+			return reasonAPI4xx
+		}
+	}
+
+	if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) {
+		return reasonTimeout
+	}
+
+	var urlError *url.Error
+	var netError net.Error
+
+	if errors.As(err, &urlError) || errors.As(err, &netError) {
+		return reasonAPIUnreachable
+	}
+
+	return reasonUnknown
+}
+
+// quotaExceeded tells whether err is an API response refusing a request over
+// the quota of the project, which Nova and Cinder answer with a 403 or a 413,
+// and Neutron with a 409
+func quotaExceeded(err error) bool {
+	var response gophercloud.ErrUnexpectedResponseCode
+	var forbidden gophercloud.ErrDefault403
+	var conflict gophercloud.ErrDefault409
+
+	switch {
+	case errors.As(err, &forbidden):
+		response = forbidden.ErrUnexpectedResponseCode
+	case errors.As(err, &conflict):
+		response = conflict.ErrUnexpectedResponseCode
+	case errors.As(err, &response) && response.Actual == http.StatusRequestEntityTooLarge:
+	default:
+		return false
+	}
+
+	return strings.Contains(strings.ToLower(string(response.Body)), "quota")
+}
+
+// sshReason returns the reason of the last error met while connecting to an
+// instance over SSH
+func sshReason(err error) string {
+	switch {
+	case err == nil:
+		return reasonTimeout
+	case strings.Contains(err.Error(), errHostKeyMismatch.Error()):
+		return reasonHostKeyMismatch
+	case strings.Contains(err.Error(), "unable to authenticate"):
+		return reasonSSHAuth
+	default:
+		return reasonSSHConnection
+	}
+}
+
+// lastError is the last failure of a probe, kept for /debug/errors
+type lastError struct {
+	time   time.Time
+	cloud  string
+	probe  string
+	step   string
+	reason string
+	err    error
+}
+
+var (
+	lastErrorsMutex sync.Mutex
+	lastErrors      = map[string]lastError{}
+)
+
+func recordError(e lastError) {
+	lastErrorsMutex.Lock()
+	defer lastErrorsMutex.Unlock()
+
+	lastErrors[e.cloud+"/"+e.probe] = e
+}
+
+// debugErrorsHandler serves the raw message of the last error of every probe
+func debugErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	lastErrorsMutex.Lock()
+	defer lastErrorsMutex.Unlock()
+
+	keys := make([]string, 0, len(lastErrors))
+
+	for key := range lastErrors {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	for _, key := range keys {
+		e := lastErrors[key]
+		fmt.Fprintf(w, "%s cloud=%q probe=%q step=%q reason=%q: %s\n", e.time.Format(time.RFC3339), e.cloud, e.probe, e.step, e.reason, e.err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+func TestClassifyError(t *testing.T) {
+	response := func(code int, body string) gophercloud.ErrUnexpectedResponseCode {
+		return gophercloud.ErrUnexpectedResponseCode{Actual: code, Body: []byte(body)}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "explicit reason mentioning quota",
+			err:  withReason(reasonCommandFailed, fmt.Errorf("commands failed: quota")),
+			want: reasonCommandFailed,
+		},
+		{
+			name: "forbidden over quota",
+			err:  fmt.Errorf("server creation failed: %w", gophercloud.ErrDefault403{ErrUnexpectedResponseCode: response(http.StatusForbidden, `{"forbidden": {"message": "Quota exceeded for instances"}}`)}),
+			want: reasonQuotaExceeded,
+		},
+		{
+			name: "request too large over quota",
+			err:  response(http.StatusRequestEntityTooLarge, `{"overLimit": {"message": "VolumeSizeExceedsAvailableQuota"}}`),
+			want: reasonQuotaExceeded,
+		},
+		{
+			name: "forbidden",
+			err:  gophercloud.ErrDefault403{ErrUnexpectedResponseCode: response(http.StatusForbidden, `{"forbidden": {"message": "Policy does not allow"}}`)},
+			want: reasonForbidden,
+		},
+		{
+			name: "bad request mentioning quota",
+			err:  gophercloud.ErrDefault400{ErrUnexpectedResponseCode: response(http.StatusBadRequest, `{"badRequest": {"message": "invalid quota class"}}`)},
+			want: reasonBadRequest,
+		},
+		{
+			name: "unknown",
+			err:  fmt.Errorf("quota"),
+			want: reasonUnknown,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := classifyError(context.Background(), test.err); got != test.want {
+				t.Errorf("got reason %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,898 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeObject is an OpenStack resource as serialized by the APIs
+type fakeObject map[string]interface{}
+
+// fakeCollection holds the resources of one kind of a fake service
+type fakeCollection struct {
+	// singular and plural are the JSON keys wrapping a single resource and
+	// a list of resources
+	singular string
+	plural   string
+	objects  map[string]fakeObject
+	// transitions lists the statuses a resource goes through, one per GET
+	transitions []string
+	gets        map[string]int
+	// createStatus is the status code of successful creations
+	createStatus int
+}
+
+func newFakeCollection(singular string, plural string) *fakeCollection {
+	return &fakeCollection{
+		singular:     singular,
+		plural:       plural,
+		objects:      map[string]fakeObject{},
+		gets:         map[string]int{},
+		createStatus: http.StatusCreated,
+	}
+}
+
+func (c *fakeCollection) list() []fakeObject {
+	ids := make([]string, 0, len(c.objects))
+
+	for id := range c.objects {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	list := make([]fakeObject, 0, len(ids))
+
+	for _, id := range ids {
+		list = append(list, c.objects[id])
+	}
+
+	return list
+}
+
+// get returns a resource after moving it to its next status, the status is
+// left unchanged once the last transition is reached
+func (c *fakeCollection) get(id string) (fakeObject, bool) {
+	object, ok := c.objects[id]
+
+	if !ok {
+		return nil, false
+	}
+
+	c.gets[id]++
+
+	if i := c.gets[id]; i < len(c.transitions) {
+		object["status"] = c.transitions[i]
+	}
+
+	return object, true
+}
+
+// fakeResponse is a canned response returned instead of the regular one
+type fakeResponse struct {
+	status int
+	body   string
+}
+
+// fakeCloud is an in-process stand-in for the Keystone, Nova, Cinder, Glance,
+// Neutron and Swift APIs called by the probes and the garbage collector
+type fakeCloud struct {
+	t      *testing.T
+	server *httptest.Server
+	mutex  sync.Mutex
+	nextID int
+	// tokens counts the tokens issued
+	tokens int
+
+	images         *fakeCollection
+	flavors        *fakeCollection
+	keypairs       *fakeCollection
+	servers        *fakeCollection
+	serverGroups   *fakeCollection
+	volumes        *fakeCollection
+	snapshots      *fakeCollection
+	networks       *fakeCollection
+	securityGroups *fakeCollection
+	rules          *fakeCollection
+	floatingIPs    *fakeCollection
+	ports          *fakeCollection
+
+	// availabilityZones tells whether each compute zone is available, servers
+	// created in other zones go to ERROR
+	availabilityZones map[string]bool
+
+	// ipv6Address is added to the port of the servers when set
+	ipv6Address string
+
+	// containers holds the Swift objects by container and object name
+	containers map[string]map[string][]byte
+
+	// consoleOutput returns the console output of a server on the given call,
+	// counted from 1
+	consoleOutput func(server fakeObject, call int) string
+	consoleCalls  map[string]int
+	// actionStatuses holds the status servers reach at once after each
+	// action, and actions lists the actions performed
+	actionStatuses map[string]string
+	actions        []string
+
+	// failures holds canned responses by method and path prefix, such as
+	// "POST /network/v2.0/floatingips"
+	failures map[string]fakeResponse
+}
+
+func newFakeCloud(t *testing.T) *fakeCloud {
+	f := &fakeCloud{
+		t:                 t,
+		images:            newFakeCollection("image", "images"),
+		flavors:           newFakeCollection("flavor", "flavors"),
+		keypairs:          newFakeCollection("keypair", "keypairs"),
+		servers:           newFakeCollection("server", "servers"),
+		serverGroups:      newFakeCollection("server_group", "server_groups"),
+		volumes:           newFakeCollection("volume", "volumes"),
+		snapshots:         newFakeCollection("snapshot", "snapshots"),
+		networks:          newFakeCollection("network", "networks"),
+		securityGroups:    newFakeCollection("security_group", "security_groups"),
+		rules:             newFakeCollection("security_group_rule", "security_group_rules"),
+		floatingIPs:       newFakeCollection("floatingip", "floatingips"),
+		ports:             newFakeCollection("port", "ports"),
+		containers:        map[string]map[string][]byte{},
+		availabilityZones: map[string]bool{"nova": true},
+		consoleCalls:      map[string]int{},
+		actionStatuses: map[string]string{
+			"reboot":        "ACTIVE",
+			"os-stop":       "SHUTOFF",
+			"os-start":      "ACTIVE",
+			"resize":        "VERIFY_RESIZE",
+			"confirmResize": "ACTIVE",
+		},
+		failures: map[string]fakeResponse{},
+		consoleOutput: func(server fakeObject, call int) string {
+			return "cloud-init finished\n"
+		},
+	}
+
+	f.volumes.transitions = []string{"creating", "available"}
+	f.servers.transitions = []string{"BUILD", "ACTIVE"}
+	f.snapshots.transitions = []string{"creating", "available"}
+	f.volumes.createStatus = http.StatusAccepted
+	f.snapshots.createStatus = http.StatusAccepted
+	f.servers.createStatus = http.StatusAccepted
+	f.serverGroups.createStatus = http.StatusOK
+
+	f.images.objects["image-1"] = fakeObject{"id": "image-1", "name": "cirros", "status": "active", "created_at": "2019-01-01T00:00:00Z"}
+	f.flavors.objects["flavor-1"] = fakeObject{"id": "flavor-1", "name": "m1.tiny", "ram": 512, "vcpus": 1, "disk": 1}
+	f.networks.objects["network-private"] = fakeObject{"id": "network-private", "name": "private"}
+	f.networks.objects["network-public"] = fakeObject{"id": "network-public", "name": "public", "router:external": true}
+
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+// cloud returns the settings to reach the fake cloud
+func (f *fakeCloud) cloud() *cloudConfig {
+	cloud := &cloudConfig{name: "fake"}
+
+	cloud.Auth.AuthURL = f.server.URL + "/identity/v3"
+	cloud.Auth.Username = "user"
+	cloud.Auth.Password = "password"
+	cloud.Auth.UserDomainName = "Default"
+	cloud.Auth.ProjectName = "project"
+	cloud.Auth.ProjectDomainName = "Default"
+
+	return cloud
+}
+
+// fail makes the fake answer requests to method and any path starting with
+// prefix with a canned error
+func (f *fakeCloud) fail(method string, prefix string, status int, body string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.failures[method+" "+prefix] = fakeResponse{status: status, body: body}
+}
+
+// newID returns a new UUID, as some clients check the format of IDs
+func (f *fakeCloud) newID() string {
+	f.nextID++
+
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", f.nextID)
+}
+
+func (f *fakeCloud) writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		f.t.Errorf("fake cloud: cannot encode response: %s", err)
+	}
+}
+
+func (f *fakeCloud) readJSON(r *http.Request) map[string]interface{} {
+	body := map[string]interface{}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		f.t.Errorf("fake cloud: cannot decode %s %s: %s", r.Method, r.URL.Path, err)
+	}
+
+	return body
+}
+
+func (f *fakeCloud) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	key := r.Method + " " + r.URL.Path
+
+	for prefix, failure := range f.failures {
+		if strings.HasPrefix(key, prefix) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(failure.status)
+			fmt.Fprint(w, failure.body)
+			return
+		}
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch parts[0] {
+	case "identity":
+		f.serveIdentity(w, r)
+	case "compute":
+		f.serveCompute(w, r, parts[1:])
+	case "volume":
+		f.serveVolume(w, r, parts[1:])
+	case "image":
+		f.serveImage(w, r, parts[1:])
+	case "network":
+		f.serveNetwork(w, r, parts[2:])
+	case "object-store":
+		f.serveObjectStore(w, r, parts[1:])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeCloud) serveIdentity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/v3/auth/tokens") {
+		http.NotFound(w, r)
+		return
+	}
+
+	endpoint := func(service string, kind string, path string) fakeObject {
+		return fakeObject{
+			"type": kind,
+			"name": service,
+			"endpoints": []fakeObject{{
+				"id":        service,
+				"interface": "public",
+				"region":    "RegionOne",
+				"region_id": "RegionOne",
+				"url":       f.server.URL + path,
+			}},
+		}
+	}
+
+	f.tokens++
+
+	w.Header().Set("X-Subject-Token", "fake-token")
+	f.writeJSON(w, http.StatusCreated, fakeObject{
+		"token": fakeObject{
+			"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			"project":    fakeObject{"id": "project-1", "name": "project"},
+			"catalog": []fakeObject{
+				endpoint("keystone", "identity", "/identity/v3/"),
+				endpoint("nova", "compute", "/compute/v2.1/"),
+				endpoint("cinderv2", "volumev2", "/volume/v2/project-1/"),
+				endpoint("glance", "image", "/image/"),
+				endpoint("neutron", "network", "/network/"),
+				endpoint("swift", "object-store", "/object-store/v1/AUTH_project-1/"),
+			},
+		},
+	})
+}
+
+// serveCollection implements the list, show, create and delete calls of a
+// collection, the created resources being completed by create
+func (f *fakeCloud) serveCollection(w http.ResponseWriter, r *http.Request, c *fakeCollection, path []string, create func(object fakeObject)) {
+	switch {
+	case r.Method == http.MethodGet && (len(path) == 0 || path[0] == "detail"):
+		var list []interface{}
+
+		for _, object := range c.list() {
+			if matchesQuery(object, r) {
+				list = append(list, object)
+			}
+		}
+
+		if list == nil {
+			list = []interface{}{}
+		}
+
+		f.writeJSON(w, http.StatusOK, fakeObject{c.plural: list})
+	case r.Method == http.MethodGet && len(path) == 1:
+		if object, ok := c.get(path[0]); ok {
+			f.writeJSON(w, http.StatusOK, fakeObject{c.singular: object})
+		} else {
+			f.notFound(w)
+		}
+	case r.Method == http.MethodPost && len(path) == 0:
+		object, _ := f.readJSON(r)[c.singular].(map[string]interface{})
+
+		if object == nil {
+			object = fakeObject{}
+		}
+
+		object["id"] = f.newID()
+
+		if len(c.transitions) > 0 {
+			object["status"] = c.transitions[0]
+		}
+
+		if create != nil {
+			create(object)
+		}
+
+		c.objects[object["id"].(string)] = object
+		f.writeJSON(w, c.createStatus, fakeObject{c.singular: object})
+	case r.Method == http.MethodPut && len(path) == 1:
+		object, ok := c.objects[path[0]]
+
+		if !ok {
+			f.notFound(w)
+			return
+		}
+
+		update, _ := f.readJSON(r)[c.singular].(map[string]interface{})
+
+		for key, value := range update {
+			object[key] = value
+		}
+
+		f.writeJSON(w, http.StatusOK, fakeObject{c.singular: object})
+	case r.Method == http.MethodDelete && len(path) == 1:
+		if _, ok := c.objects[path[0]]; !ok {
+			f.notFound(w)
+			return
+		}
+
+		delete(c.objects, path[0])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// matchesQuery tells whether object matches the filters of a list request
+func matchesQuery(object fakeObject, r *http.Request) bool {
+	for key, values := range r.URL.Query() {
+		value, ok := object[key]
+
+		if !ok {
+			continue
+		}
+
+		if fmt.Sprint(value) != values[0] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f *fakeCloud) notFound(w http.ResponseWriter) {
+	f.writeJSON(w, http.StatusNotFound, fakeObject{"itemNotFound": fakeObject{"code": 404, "message": "not found"}})
+}
+
+func (f *fakeCloud) serveCompute(w http.ResponseWriter, r *http.Request, path []string) {
+	// Skip the version of the API
+	path = path[1:]
+
+	switch path[0] {
+	case "flavors":
+		f.serveCollection(w, r, f.flavors, path[1:], nil)
+	case "os-server-groups":
+		f.serveCollection(w, r, f.serverGroups, path[1:], nil)
+	case "os-keypairs":
+		f.serveKeypairs(w, r, path[1:])
+	case "os-availability-zone":
+		var zones []fakeObject
+
+		for _, name := range sortedKeys(f.availabilityZones) {
+			zones = append(zones, fakeObject{"zoneName": name, "zoneState": fakeObject{"available": f.availabilityZones[name]}})
+		}
+
+		f.writeJSON(w, http.StatusOK, fakeObject{"availabilityZoneInfo": zones})
+	case "os-volumes_boot":
+		f.serveCollection(w, r, f.servers, path[1:], f.createServer)
+	case "servers":
+		if len(path) == 3 && path[2] == "action" {
+			f.serveServerAction(w, r, path[1])
+			return
+		}
+
+		if len(path) >= 3 && path[2] == "os-volume_attachments" {
+			f.serveVolumeAttachments(w, r, path[1], path[3:])
+			return
+		}
+
+		f.serveCollection(w, r, f.servers, path[1:], f.createServer)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// createServer plugs a new server into the private network
+func (f *fakeCloud) createServer(server fakeObject) {
+	if zone, ok := server["availability_zone"].(string); ok && !f.availabilityZones[zone] {
+		server["status"] = "ERROR"
+		f.servers.gets[server["id"].(string)] = len(f.servers.transitions)
+	}
+
+	portID := f.newID()
+
+	f.ports.objects[portID] = fakeObject{
+		"id":         portID,
+		"device_id":  server["id"],
+		"network_id": "network-private",
+		"fixed_ips":  []fakeObject{{"ip_address": fmt.Sprintf("10.0.0.%d", 10+len(f.ports.objects))}},
+	}
+
+	if f.ipv6Address != "" {
+		port := f.ports.objects[portID]
+		port["fixed_ips"] = append(port["fixed_ips"].([]fakeObject), fakeObject{"ip_address": "fe80::10"}, fakeObject{"ip_address": f.ipv6Address})
+	}
+}
+
+// serveKeypairs serves keypairs which, unlike other resources, are named and
+// listed with each entry wrapped in its own object
+func (f *fakeCloud) serveKeypairs(w http.ResponseWriter, r *http.Request, path []string) {
+	switch {
+	case r.Method == http.MethodGet && len(path) == 0:
+		var list []fakeObject
+
+		for _, keypair := range f.keypairs.list() {
+			list = append(list, fakeObject{"keypair": keypair})
+		}
+
+		f.writeJSON(w, http.StatusOK, fakeObject{"keypairs": list})
+	case r.Method == http.MethodPost && len(path) == 0:
+		keypair, _ := f.readJSON(r)["keypair"].(map[string]interface{})
+		f.keypairs.objects[keypair["name"].(string)] = keypair
+		f.writeJSON(w, http.StatusOK, fakeObject{"keypair": keypair})
+	case r.Method == http.MethodDelete && len(path) == 1:
+		if _, ok := f.keypairs.objects[path[0]]; !ok {
+			f.notFound(w)
+			return
+		}
+
+		delete(f.keypairs.objects, path[0])
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeCloud) serveServerAction(w http.ResponseWriter, r *http.Request, id string) {
+	server, ok := f.servers.objects[id]
+
+	if !ok {
+		f.notFound(w)
+		return
+	}
+
+	action := f.readJSON(r)
+
+	if _, ok := action["os-getConsoleOutput"]; ok {
+		f.consoleCalls[id]++
+		f.writeJSON(w, http.StatusOK, fakeObject{"output": f.consoleOutput(server, f.consoleCalls[id])})
+		return
+	}
+
+	for name, status := range f.actionStatuses {
+		if _, ok := action[name]; ok {
+			server["status"] = status
+			f.actions = append(f.actions, name)
+
+			if resize, ok := action["resize"].(map[string]interface{}); ok {
+				server["flavor"] = fakeObject{"id": resize["flavorRef"]}
+			}
+
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+	}
+
+	http.Error(w, "unsupported action", http.StatusBadRequest)
+}
+
+// serveVolumeAttachments attaches volumes to servers, the ID of an attachment
+// being the ID of the volume as in Nova
+func (f *fakeCloud) serveVolumeAttachments(w http.ResponseWriter, r *http.Request, serverID string, path []string) {
+	if _, ok := f.servers.objects[serverID]; !ok {
+		f.notFound(w)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && len(path) == 0:
+		attachment, _ := f.readJSON(r)["volumeAttachment"].(map[string]interface{})
+		volumeID, _ := attachment["volumeId"].(string)
+		volume, ok := f.volumes.objects[volumeID]
+
+		if !ok {
+			f.notFound(w)
+			return
+		}
+
+		volume["status"] = "in-use"
+		volume["attachments"] = []fakeObject{{"server_id": serverID, "attachment_id": volumeID}}
+
+		f.writeJSON(w, http.StatusOK, fakeObject{"volumeAttachment": fakeObject{
+			"id":       volumeID,
+			"device":   "/dev/vdb",
+			"serverId": serverID,
+			"volumeId": volumeID,
+		}})
+	case r.Method == http.MethodDelete && len(path) == 1:
+		volume, ok := f.volumes.objects[path[0]]
+
+		if !ok || volume["status"] != "in-use" {
+			f.notFound(w)
+			return
+		}
+
+		volume["status"] = "available"
+		volume["attachments"] = []fakeObject{}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeCloud) serveVolume(w http.ResponseWriter, r *http.Request, path []string) {
+	// Skip the version of the API and the project ID
+	path = path[2:]
+
+	switch path[0] {
+	case "volumes":
+		// Like Cinder, volumes with snapshots cannot be deleted
+		if r.Method == http.MethodDelete && len(path) == 2 {
+			for _, snapshot := range f.snapshots.objects {
+				if snapshot["volume_id"] == path[1] {
+					f.writeJSON(w, http.StatusBadRequest, fakeObject{"badRequest": fakeObject{"message": "Volume cannot be deleted while it has snapshots"}})
+					return
+				}
+			}
+		}
+
+		f.serveCollection(w, r, f.volumes, path[1:], nil)
+	case "snapshots":
+		f.serveCollection(w, r, f.snapshots, path[1:], nil)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeCloud) serveImage(w http.ResponseWriter, r *http.Request, path []string) {
+	// Skip the version of the API
+	path = path[1:]
+
+	if path[0] != "images" {
+		http.NotFound(w, r)
+		return
+	}
+
+	f.serveCollection(w, r, f.images, path[1:], nil)
+}
+
+func (f *fakeCloud) serveNetwork(w http.ResponseWriter, r *http.Request, path []string) {
+	switch path[0] {
+	case "networks":
+		f.serveCollection(w, r, f.networks, path[1:], nil)
+	case "security-groups":
+		f.serveCollection(w, r, f.securityGroups, path[1:], nil)
+	case "security-group-rules":
+		f.serveCollection(w, r, f.rules, path[1:], nil)
+	case "floatingips":
+		f.serveCollection(w, r, f.floatingIPs, path[1:], func(fip fakeObject) {
+			fip["floating_ip_address"] = "127.0.0.1"
+		})
+	case "ports":
+		f.serveCollection(w, r, f.ports, path[1:], nil)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeCloud) serveObjectStore(w http.ResponseWriter, r *http.Request, path []string) {
+	// Skip the version of the API and the account
+	path = path[2:]
+
+	switch {
+	case len(path) == 0 && r.Method == http.MethodGet:
+		var list []fakeObject
+
+		for _, name := range sortedKeys(f.containers) {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) && name > r.URL.Query().Get("marker") {
+				list = append(list, fakeObject{"name": name, "count": len(f.containers[name]), "bytes": 0})
+			}
+		}
+
+		if list == nil {
+			list = []fakeObject{}
+		}
+
+		f.writeJSON(w, http.StatusOK, list)
+	case len(path) == 1:
+		f.serveContainer(w, r, path[0])
+	case len(path) == 2:
+		f.serveSwiftObject(w, r, path[0], path[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeCloud) serveContainer(w http.ResponseWriter, r *http.Request, name string) {
+	container, exists := f.containers[name]
+
+	switch r.Method {
+	case http.MethodPut:
+		if !exists {
+			f.containers[name] = map[string][]byte{}
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodHead:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("X-Container-Object-Count", strconv.Itoa(len(container)))
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var list []fakeObject
+
+		for _, objectName := range sortedKeys(container) {
+			if objectName <= r.URL.Query().Get("marker") {
+				continue
+			}
+
+			list = append(list, fakeObject{
+				"name":          objectName,
+				"bytes":         len(container[objectName]),
+				"hash":          "",
+				"content_type":  "application/octet-stream",
+				"last_modified": "2019-01-01T00:00:00.000000",
+			})
+		}
+
+		if list == nil {
+			list = []fakeObject{}
+		}
+
+		f.writeJSON(w, http.StatusOK, list)
+	case http.MethodDelete:
+		switch {
+		case !exists:
+			w.WriteHeader(http.StatusNotFound)
+		case len(container) > 0:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			delete(f.containers, name)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeCloud) serveSwiftObject(w http.ResponseWriter, r *http.Request, containerName string, name string) {
+	container, exists := f.containers[containerName]
+
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	content, exists := container[name]
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := ioutil.ReadAll(r.Body)
+
+		if err != nil {
+			f.t.Errorf("fake cloud: cannot read object: %s", err)
+		}
+
+		container[name] = body
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(content)
+	case http.MethodDelete:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		delete(container, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+
+	switch m := m.(type) {
+	case map[string]map[string][]byte:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string][]byte:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string]bool:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// testModule returns the settings of prober matching the resources of the
+// fake cloud
+func testModule(prober string) *moduleConfig {
+	return &moduleConfig{
+		name:              prober,
+		Prober:            prober,
+		Timeout:           5 * time.Second,
+		Image:             "cirros",
+		Flavor:            "m1.tiny",
+		InternalNetwork:   "private",
+		ExternalNetwork:   "public",
+		User:              "ubuntu",
+		SSHPort:           defaultSSHPort,
+		PingCount:         defaultPingCount,
+		VolumeSize:        1,
+		BootMode:          bootModeVolume,
+		ServerGroupPolicy: serverGroupPolicyAntiAffinity,
+		ObjectSize:        1024,
+	}
+}
+
+// newSpawnFixture returns a fake cloud whose servers print the host key of a
+// fake SSH server on their console, along with a module of prober reaching
+// them on the port of the SSH server
+func newSpawnFixture(t *testing.T, prober string) (*fakeCloud, *fakeSSHServer, *moduleConfig) {
+	f := newFakeCloud(t)
+	s := newFakeSSHServer(t)
+
+	f.consoleOutput = func(server fakeObject, call int) string {
+		return s.consoleOutput()
+	}
+
+	module := testModule(prober)
+	module.SSHPort = s.port()
+
+	return f, s, module
+}
+
+// probeResult is the outcome of a run as exported by its success metric
+type probeResult struct {
+	success bool
+	reason  string
+	step    string
+	// registry holds the metrics of the run
+	registry *prometheus.Registry
+}
+
+// runTestProbe runs module against cloud and returns the outcome exported
+func runTestProbe(t *testing.T, module *moduleConfig, cloud *cloudConfig) probeResult {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	runProbe(context.Background(), module, cloud, registry)
+
+	families, err := registry.Gather()
+
+	if err != nil {
+		t.Fatalf("cannot gather metrics: %s", err)
+	}
+
+	name := program + "_" + module.Prober + "_success"
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			result := probeResult{success: metric.GetGauge().GetValue() == 1, registry: registry}
+
+			for _, label := range metric.GetLabel() {
+				switch label.GetName() {
+				case "reason":
+					result.reason = label.GetValue()
+				case "step":
+					result.step = label.GetValue()
+				}
+			}
+
+			return result
+		}
+	}
+
+	t.Fatalf("metric %s not found", name)
+
+	return probeResult{}
+}
+
+// value returns the value of the gauge with the given name and labels among
+// the metrics of the run
+func (r probeResult) value(t *testing.T, name string, labels map[string]string) (float64, bool) {
+	t.Helper()
+
+	families, err := r.registry.Gather()
+
+	if err != nil {
+		t.Fatalf("cannot gather metrics: %s", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+	metrics:
+		for _, metric := range family.GetMetric() {
+			values := map[string]string{}
+
+			for _, label := range metric.GetLabel() {
+				values[label.GetName()] = label.GetValue()
+			}
+
+			for name, value := range labels {
+				if values[name] != value {
+					continue metrics
+				}
+			}
+
+			return metric.GetGauge().GetValue(), true
+		}
+	}
+
+	return 0, false
+}
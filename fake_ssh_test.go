@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeSSHServer is an in-process stand-in for the SSH server of an instance
+type fakeSSHServer struct {
+	t        *testing.T
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	// hostKey is the key the server authenticates with, in the format of the
+	// console output of cloud-init
+	hostKey string
+
+	mutex sync.Mutex
+	// drop is the number of connections closed before the handshake, to
+	// simulate a server which is still booting
+	drop        int
+	connections int
+	// authorizedKey is the only client key accepted, any key when nil
+	authorizedKey ssh.PublicKey
+	// exec returns the output and exit status of a command
+	exec func(command string) (string, uint32)
+}
+
+func newFakeSSHServer(t *testing.T) *fakeSSHServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeSSHServer{
+		t:        t,
+		listener: listener,
+		hostKey:  strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))),
+		exec: func(command string) (string, uint32) {
+			if command == "/usr/bin/whoami" {
+				return "ubuntu\n", 0
+			}
+
+			return "", 127
+		},
+	}
+
+	s.config = &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+
+			if s.authorizedKey != nil && string(key.Marshal()) != string(s.authorizedKey.Marshal()) {
+				return nil, fmt.Errorf("unknown public key for %s", conn.User())
+			}
+
+			return nil, nil
+		},
+	}
+	s.config.AddHostKey(signer)
+
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return s
+}
+
+// address returns the host and port the server listens on
+func (s *fakeSSHServer) address() string {
+	return s.listener.Addr().String()
+}
+
+// port returns the port the server listens on
+func (s *fakeSSHServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// reachAt has the SSH connections to host, on the port of the server, reach the
+// server, as if it was listening on that address. It returns the addresses
+// dialed so far.
+func (s *fakeSSHServer) reachAt(host string) func() []string {
+	var mutex sync.Mutex
+	var dialed []string
+
+	address := net.JoinHostPort(host, strconv.Itoa(s.port()))
+
+	sshDialer = func(network string, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		mutex.Lock()
+		dialed = append(dialed, addr)
+		mutex.Unlock()
+
+		if addr == address {
+			addr = s.address()
+		}
+
+		return ssh.Dial(network, addr, config)
+	}
+
+	s.t.Cleanup(func() { sshDialer = ssh.Dial })
+
+	return func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		return append([]string(nil), dialed...)
+	}
+}
+
+// consoleOutput returns a console output holding the host key of the server
+func (s *fakeSSHServer) consoleOutput() string {
+	return "-----BEGIN SSH HOST KEY KEYS-----\n" + s.hostKey + "\n-----END SSH HOST KEY KEYS-----\n"
+}
+
+// connectionCount returns the number of connections accepted so far
+func (s *fakeSSHServer) connectionCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.connections
+}
+
+func (s *fakeSSHServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		s.connections++
+		drop := s.connections <= s.drop
+		s.mutex.Unlock()
+
+		if drop {
+			conn.Close()
+			continue
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSSHServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	_, channels, requests, err := ssh.NewServerConn(conn, s.config)
+
+	if err != nil {
+		return
+	}
+
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+
+		if err != nil {
+			return
+		}
+
+		go s.session(channel, requests)
+	}
+}
+
+func (s *fakeSSHServer) session(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for request := range requests {
+		if request.Type != "exec" || len(request.Payload) < 4 {
+			request.Reply(false, nil)
+			continue
+		}
+
+		command := string(request.Payload[4:])
+		request.Reply(true, nil)
+
+		output, status := s.exec(command)
+		channel.Write([]byte(output))
+
+		exitStatus := make([]byte, 4)
+		binary.BigEndian.PutUint32(exitStatus, status)
+		channel.SendRequest("exit-status", false, exitStatus)
+
+		return
+	}
+}
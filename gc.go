@@ -9,11 +9,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v2/snapshots"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/keypairs"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
@@ -69,23 +71,36 @@ func shouldDelete(name string) bool {
 		return false
 	}
 
-	return time.Since(timestamp) > requestTimeout
+	return time.Since(timestamp) > maxTimeout()
 }
 
 func garbageCollector() error {
-	provider, err := getProvider(context.TODO())
+	var lastErr error
+
+	for _, cloud := range allClouds() {
+		if err := garbageCollectCloud(cloud); err != nil {
+			log.Printf("garbage collector error on cloud %s: %s\n", cloud.name, err)
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+func garbageCollectCloud(cloud *cloudConfig) error {
+	provider, err := getProvider(context.TODO(), cloud)
 
 	if err != nil {
 		return fmt.Errorf("openstack authentication failure: %f", err)
 	}
 
-	computeClient, err := openstack.NewComputeV2(provider, gophercloud.EndpointOpts{})
+	computeClient, err := openstack.NewComputeV2(provider, cloud.endpointOpts())
 
 	if err != nil {
 		return fmt.Errorf("nova client failure: %f", err)
 	}
 
-	networkClient, err := openstack.NewNetworkV2(provider, gophercloud.EndpointOpts{})
+	networkClient, err := openstack.NewNetworkV2(provider, cloud.endpointOpts())
 
 	if err != nil {
 		return fmt.Errorf("neutron client failure: %s", err)
@@ -146,27 +161,37 @@ func garbageCollector() error {
 		log.Printf("Failed to list left over security groups: %s\n", err)
 	}
 
-	if err := gcKeypairs(provider); err != nil {
+	if err := gcKeypairs(provider, cloud); err != nil {
 		log.Printf("keypair garbage collection failure: %s", err)
 	}
 
-	if err := gcFloatingIPs(provider); err != nil {
+	if err := gcServerGroups(provider, cloud); err != nil {
+		log.Printf("server group garbage collection failure: %s", err)
+	}
+
+	if err := gcFloatingIPs(provider, cloud); err != nil {
 		log.Printf("floating ip garbage collection failure: %s", err)
 	}
 
-	if err := gcVolumes(provider); err != nil {
+	// Snapshots go first as Cinder refuses to delete volumes with snapshots
+
+	if err := gcSnapshots(provider, cloud); err != nil {
+		log.Printf("snapshots garbage collection failure: %s", err)
+	}
+
+	if err := gcVolumes(provider, cloud); err != nil {
 		log.Printf("volumes garbage collection failure: %s", err)
 	}
 
-	if err := gcObjectStorage(provider); err != nil {
+	if err := gcObjectStorage(provider, cloud); err != nil {
 		log.Printf("object store garbage collection failure: %s", err)
 	}
 
 	return nil
 }
 
-func gcObjectStorage(provider *gophercloud.ProviderClient) error {
-	objectClient, err := openstack.NewObjectStorageV1(provider, gophercloud.EndpointOpts{})
+func gcObjectStorage(provider *gophercloud.ProviderClient, cloud *cloudConfig) error {
+	objectClient, err := openstack.NewObjectStorageV1(provider, cloud.endpointOpts())
 
 	if err != nil {
 		return fmt.Errorf("object storage client failure: %s", err)
@@ -229,8 +254,8 @@ func gcObjectStorage(provider *gophercloud.ProviderClient) error {
 	return nil
 }
 
-func gcFloatingIPs(provider *gophercloud.ProviderClient) error {
-	networkClient, err := openstack.NewNetworkV2(provider, gophercloud.EndpointOpts{})
+func gcFloatingIPs(provider *gophercloud.ProviderClient, cloud *cloudConfig) error {
+	networkClient, err := openstack.NewNetworkV2(provider, cloud.endpointOpts())
 
 	if err != nil {
 		return fmt.Errorf("network client failure: %s", err)
@@ -261,8 +286,8 @@ func gcFloatingIPs(provider *gophercloud.ProviderClient) error {
 	return nil
 }
 
-func gcKeypairs(provider *gophercloud.ProviderClient) error {
-	computeClient, err := openstack.NewComputeV2(provider, gophercloud.EndpointOpts{})
+func gcKeypairs(provider *gophercloud.ProviderClient, cloud *cloudConfig) error {
+	computeClient, err := openstack.NewComputeV2(provider, cloud.endpointOpts())
 
 	if err != nil {
 		return fmt.Errorf("compute client failure: %s", err)
@@ -293,8 +318,76 @@ func gcKeypairs(provider *gophercloud.ProviderClient) error {
 	return nil
 }
 
-func gcVolumes(provider *gophercloud.ProviderClient) error {
-	volumeClient, err := openstack.NewBlockStorageV2(provider, gophercloud.EndpointOpts{})
+func gcServerGroups(provider *gophercloud.ProviderClient, cloud *cloudConfig) error {
+	computeClient, err := openstack.NewComputeV2(provider, cloud.endpointOpts())
+
+	if err != nil {
+		return fmt.Errorf("compute client failure: %s", err)
+	}
+
+	if err := servergroups.List(computeClient).EachPage(func(page pagination.Page) (bool, error) {
+		serverGroups, err := servergroups.ExtractServerGroups(page)
+
+		if err != nil {
+			log.Printf("failed to extract server groups from page: %s", err)
+		}
+
+		for _, serverGroup := range serverGroups {
+			if shouldDelete(serverGroup.Name) {
+				if err := servergroups.Delete(computeClient, serverGroup.ID).ExtractErr(); err != nil {
+					log.Printf("server group %s deletion failed: %s", serverGroup.Name, err)
+				} else {
+					log.Printf("server group %s deleted", serverGroup.Name)
+				}
+			}
+		}
+
+		return false, nil
+	}); err != nil {
+		return fmt.Errorf("failed to list server groups: %s", err)
+	}
+
+	return nil
+}
+
+func gcSnapshots(provider *gophercloud.ProviderClient, cloud *cloudConfig) error {
+	volumeClient, err := openstack.NewBlockStorageV2(provider, cloud.endpointOpts())
+
+	if err != nil {
+		return fmt.Errorf("cinder client failure: %s", err)
+	}
+
+	if err := snapshots.List(volumeClient, snapshots.ListOpts{}).EachPage(func(page pagination.Page) (bool, error) {
+		snapshotList, err := snapshots.ExtractSnapshots(page)
+
+		if err != nil {
+			log.Printf("failed to extract snapshots from page: %s", err)
+		}
+
+		for _, snapshot := range snapshotList {
+			if snapshot.Status != "available" && snapshot.Status != "error" {
+				continue
+			}
+
+			if shouldDelete(snapshot.Name) {
+				if err := snapshots.Delete(volumeClient, snapshot.ID).ExtractErr(); err != nil {
+					log.Printf("snapshot %s deletion failed: %s", snapshot.Name, err)
+				} else {
+					log.Printf("snapshot %s deleted", snapshot.Name)
+				}
+			}
+		}
+
+		return true, nil
+	}); err != nil {
+		return fmt.Errorf("failed to list snapshots: %s", err)
+	}
+
+	return nil
+}
+
+func gcVolumes(provider *gophercloud.ProviderClient, cloud *cloudConfig) error {
+	volumeClient, err := openstack.NewBlockStorageV2(provider, cloud.endpointOpts())
 
 	if err != nil {
 		return fmt.Errorf("cinder client failure: %s", err)
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGarbageCollectCloud(t *testing.T) {
+	requestTimeout = time.Minute
+
+	f := newFakeCloud(t)
+
+	old := resourceTag + "-abcdefgh-" + strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	recent := createName()
+
+	for i, name := range []string{old, recent, "unrelated"} {
+		id := strconv.Itoa(i)
+
+		f.servers.objects["server-"+id] = fakeObject{"id": "server-" + id, "name": name, "status": "ACTIVE"}
+		f.securityGroups.objects["sg-"+id] = fakeObject{"id": "sg-" + id, "name": name}
+		f.serverGroups.objects["server-group-"+id] = fakeObject{"id": "server-group-" + id, "name": name, "policies": []string{"anti-affinity"}}
+		f.keypairs.objects[name] = fakeObject{"name": name, "public_key": "ssh-rsa AAAA"}
+		f.floatingIPs.objects["fip-"+id] = fakeObject{"id": "fip-" + id, "description": name}
+		f.volumes.objects["volume-"+id] = fakeObject{"id": "volume-" + id, "name": name, "status": "available"}
+		f.snapshots.objects["snapshot-"+id] = fakeObject{"id": "snapshot-" + id, "name": name, "status": "available", "volume_id": "volume-" + id}
+		f.containers[name] = map[string][]byte{"object": []byte("content")}
+	}
+
+	if err := garbageCollectCloud(f.cloud()); err != nil {
+		t.Fatal(err)
+	}
+
+	resources := map[string]map[string]fakeObject{
+		"server":         f.servers.objects,
+		"security group": f.securityGroups.objects,
+		"server group":   f.serverGroups.objects,
+		"keypair":        f.keypairs.objects,
+		"floating IP":    f.floatingIPs.objects,
+		"volume":         f.volumes.objects,
+		"snapshot":       f.snapshots.objects,
+	}
+
+	for kind, objects := range resources {
+		names := map[string]bool{}
+
+		for _, object := range objects {
+			name, _ := object["name"].(string)
+
+			if name == "" {
+				name, _ = object["description"].(string)
+			}
+
+			names[name] = true
+		}
+
+		if names[old] {
+			t.Errorf("%s %s not deleted", kind, old)
+		}
+
+		if !names[recent] || !names["unrelated"] {
+			t.Errorf("%s deleted while it should not: %v", kind, names)
+		}
+	}
+
+	if _, ok := f.containers[old]; ok {
+		t.Errorf("container %s not deleted", old)
+	}
+
+	if _, ok := f.containers[recent]; !ok {
+		t.Errorf("container %s deleted while it should not", recent)
+	}
+}
@@ -6,4 +6,5 @@ require (
 	github.com/prometheus/common v0.0.0-20181126121408-4724e9255275
 	golang.org/x/arch v0.0.0-20190312162104-788fe5ffcd8c // indirect
 	golang.org/x/crypto v0.0.0-20190211182817-74369b46fc67
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// imageResult is the outcome of the validation of an image
+type imageResult struct {
+	name string
+	time time.Time
+	// reason and step are empty when the image was validated successfully
+	reason string
+	step   string
+}
+
+// imageResults keeps the outcome of the validation of each image by cloud and
+// module across runs, so that each image is only validated once
+type imageResults struct {
+	mutex   sync.Mutex
+	results map[string]map[string]*imageResult
+}
+
+var validatedImages = newImageResults()
+
+// startTime is when the exporter started, the images created before are only
+// validated by the modules validating existing images since the results are
+// not kept across restarts
+var startTime = time.Now()
+
+func newImageResults() *imageResults {
+	return &imageResults{results: map[string]map[string]*imageResult{}}
+}
+
+// get returns the outcome of the validation of the image by the module run
+// by r, if it was validated
+func (v *imageResults) get(r *probeRun, imageID string) (*imageResult, bool) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	result, ok := v.results[r.cloud.name+"/"+r.module.name][imageID]
+
+	return result, ok
+}
+
+func (v *imageResults) record(r *probeRun, imageID string, result *imageResult) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	key := r.cloud.name + "/" + r.module.name
+
+	if v.results[key] == nil {
+		v.results[key] = map[string]*imageResult{}
+	}
+
+	v.results[key][imageID] = result
+}
+
+// matchingImages returns the active images of the cloud whose name matches the
+// image pattern of the module and which have all of its image properties, the
+// newest first, only the newest one being returned for latest_image modules.
+// Images created before the exporter started are left out unless the module
+// validates existing images.
+func matchingImages(r *probeRun, client *gophercloud.ServiceClient) ([]images.Image, error) {
+	pattern, err := regexp.Compile(r.module.ImagePattern)
+
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := images.List(client, images.ListOpts{Status: images.ImageStatusActive}).AllPages()
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot list images: %w", err)
+	}
+
+	allImages, err := images.ExtractImages(page)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var matching []images.Image
+
+images:
+	for _, image := range allImages {
+		if !pattern.MatchString(image.Name) {
+			continue
+		}
+
+		if !r.module.ValidateExistingImages && image.CreatedAt.Before(startTime) {
+			continue
+		}
+
+		for key, value := range r.module.ImageProperties {
+			if property, ok := image.Properties[key]; !ok || fmt.Sprint(property) != value {
+				continue images
+			}
+		}
+
+		matching = append(matching, image)
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].CreatedAt.After(matching[j].CreatedAt)
+	})
+
+	if r.module.LatestImage && len(matching) > 1 {
+		matching = matching[:1]
+	}
+
+	return matching, nil
+}
+
+// validateImages runs the spawn flow against the newest image matching the
+// module which was not validated yet, one image at a time so that each run
+// stays within the timeout of the module. The outcome of the validation of
+// every matching image is exported.
+func validateImages(ctx context.Context, r *probeRun) error {
+	// The module built from the command line flags would boot every image
+	if r.module.ImagePattern == "" && len(r.module.ImageProperties) == 0 {
+		return fmt.Errorf("image_pattern or image_properties must be set in the configuration file")
+	}
+
+	if err := r.step(ctx, "start"); err != nil {
+		return err
+	}
+
+	provider, err := getProvider(ctx, r.cloud)
+
+	if err != nil {
+		return err
+	}
+
+	if err := r.step(ctx, "auth_ok"); err != nil {
+		return err
+	}
+
+	imageClient, err := openstack.NewImageServiceV2(provider, r.cloud.endpointOpts())
+
+	if err != nil {
+		return fmt.Errorf("glance client failure: %w", err)
+	}
+
+	matching, err := matchingImages(r, imageClient)
+
+	if err != nil {
+		return err
+	}
+
+	if err := r.step(ctx, "images_listed"); err != nil {
+		return err
+	}
+
+	defer exportImageResults(r, matching)
+
+	for _, image := range matching {
+		if _, ok := validatedImages.get(r, image.ID); ok {
+			continue
+		}
+
+		log.Printf("Validating image %s (%s)\n", image.Name, image.ID)
+
+		// The spawn flow boots the image by its ID as images may share a name
+		module := *r.module
+		module.Image = image.ID
+		r.module = &module
+
+		err := spawnAuthenticated(ctx, r, provider)
+		result := &imageResult{name: image.Name, time: time.Now()}
+
+		if err != nil {
+			result.reason = classifyError(ctx, err)
+			result.step = r.getLastStep()
+			err = fmt.Errorf("validation of image %s (%s) failed: %w", image.Name, image.ID, err)
+		}
+
+		validatedImages.record(r, image.ID, result)
+
+		return err
+	}
+
+	log.Printf("No new image to validate among %d images\n", len(matching))
+
+	return nil
+}
+
+// exportImageResults registers into the registry of r the outcome of the
+// validation of each of the images validated so far
+func exportImageResults(r *probeRun, matching []images.Image) {
+	success := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   program + "_" + r.module.Prober,
+		Name:        "image_success",
+		Help:        "'1' when the image was booted successfully by the spawn flow",
+		ConstLabels: r.labels,
+	},
+		[]string{"image", "image_id", "reason", "step"},
+	)
+
+	timestamp := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   program + "_" + r.module.Prober,
+		Name:        "image_timestamp_seconds",
+		Help:        "Timestamp of the end of the validation of the image",
+		ConstLabels: r.labels,
+	},
+		[]string{"image", "image_id"},
+	)
+
+	r.registry.MustRegister(success)
+	r.registry.MustRegister(timestamp)
+
+	for _, image := range matching {
+		result, ok := validatedImages.get(r, image.ID)
+
+		if !ok {
+			continue
+		}
+
+		value := 0.0
+
+		if result.reason == "" {
+			value = 1
+		}
+
+		success.WithLabelValues(result.name, image.ID, result.reason, result.step).Set(value)
+		timestamp.WithLabelValues(result.name, image.ID).Set(float64(result.time.UnixNano()) / 1e9)
+	}
+}
+
+type imageValidationProbe struct{}
+
+func init() {
+	registerProbe(imageValidationProbe{}, 10*time.Minute, false)
+}
+
+func (imageValidationProbe) Name() string {
+	return "image_validation"
+}
+
+func (imageValidationProbe) Description() probeDescription {
+	return probeDescription{
+		success: "'1' when the images were listed and the new image, if any, was booted successfully",
+		timing:  "Timestamp of each step for listing the images and booting a new one",
+	}
+}
+
+func (imageValidationProbe) Run(ctx context.Context, r *probeRun) error {
+	return validateImages(ctx, r)
+}
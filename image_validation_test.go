@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestImageValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		latestImage bool
+		existing    bool
+		// created tells whether an image is created after the exporter started
+		created bool
+		// validated lists the images booted by each run
+		validated [][]string
+	}{
+		{
+			name:      "each new image",
+			existing:  true,
+			validated: [][]string{{"image-3"}, {"image-2"}, {}},
+		},
+		{
+			name:        "latest image",
+			latestImage: true,
+			existing:    true,
+			validated:   [][]string{{"image-3"}, {}},
+		},
+		{
+			name:      "images created after startup",
+			created:   true,
+			validated: [][]string{{"image-5"}, {}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validatedImages = newImageResults()
+
+			f, _, module := newSpawnFixture(t, "image_validation")
+			f.images.objects["image-2"] = fakeObject{"id": "image-2", "name": "ubuntu", "status": "active", "created_at": "2024-01-01T00:00:00Z", "os_distro": "ubuntu"}
+			f.images.objects["image-3"] = fakeObject{"id": "image-3", "name": "ubuntu", "status": "active", "created_at": "2024-02-01T00:00:00Z", "os_distro": "ubuntu"}
+			f.images.objects["image-4"] = fakeObject{"id": "image-4", "name": "debian", "status": "active", "created_at": "2024-03-01T00:00:00Z", "os_distro": "debian"}
+
+			if test.created {
+				createdAt := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+				f.images.objects["image-5"] = fakeObject{"id": "image-5", "name": "ubuntu", "status": "active", "created_at": createdAt, "os_distro": "ubuntu"}
+			}
+
+			module.ImageProperties = map[string]string{"os_distro": "ubuntu"}
+			module.LatestImage = test.latestImage
+			module.ValidateExistingImages = test.existing
+
+			if err := module.validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, want := range test.validated {
+				volumes := len(f.volumes.objects)
+				tokens := f.tokens
+				result := runTestProbe(t, module, f.cloud())
+
+				if !result.success {
+					t.Fatalf("run %d: got %+v, want success", i, result)
+				}
+
+				if f.tokens != tokens+1 {
+					t.Errorf("run %d: authenticated %d times, want once", i, f.tokens-tokens)
+				}
+
+				var booted []string
+
+				for _, volume := range f.volumes.list()[volumes:] {
+					booted = append(booted, volume["imageRef"].(string))
+				}
+
+				if len(booted) != len(want) || (len(want) > 0 && booted[0] != want[0]) {
+					t.Errorf("run %d: got images %v booted, want %v", i, booted, want)
+				}
+
+				for _, id := range test.validated[0] {
+					if value, ok := result.value(t, "openstack_client_image_validation_image_success", map[string]string{"image_id": id, "image": "ubuntu"}); !ok || value != 1 {
+						t.Errorf("run %d: got success %v (%v) for image %s, want 1", i, value, ok, id)
+					}
+
+					if value, ok := result.value(t, "openstack_client_image_validation_image_timestamp_seconds", map[string]string{"image_id": id, "image": "ubuntu"}); !ok || value == 0 {
+						t.Errorf("run %d: got timestamp %v (%v) for image %s", i, value, ok, id)
+					}
+				}
+
+				if _, ok := result.value(t, "openstack_client_image_validation_image_success", map[string]string{"image_id": "image-4"}); ok {
+					t.Errorf("run %d: got a result for image-4 which does not match", i)
+				}
+
+				if _, ok := result.value(t, "openstack_client_image_validation_image_success", map[string]string{"image_id": "image-2"}); ok && !test.existing {
+					t.Errorf("run %d: got a result for image-2 created before the exporter started", i)
+				}
+			}
+		})
+	}
+}
+
+func TestImageValidationValidation(t *testing.T) {
+	module := testModule("image_validation")
+
+	if err := module.validate(); err == nil {
+		t.Error("got no error without image pattern nor properties")
+	}
+
+	module.ImagePattern = "("
+
+	if err := module.validate(); err == nil {
+		t.Error("got no error for an invalid image pattern")
+	}
+}
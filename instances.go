@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
+	"golang.org/x/crypto/ssh"
+)
+
+// Policies of the server group of the servers booted by bootInstances, the
+// soft one allowing them on the same hypervisor when there is no other one
+const (
+	serverGroupPolicyAntiAffinity     = "anti-affinity"
+	serverGroupPolicySoftAntiAffinity = "soft-anti-affinity"
+)
+
+var serverGroupPolicies = []string{serverGroupPolicyAntiAffinity, serverGroupPolicySoftAntiAffinity}
+
+// probeInstance is one of the servers booted by the probes needing several
+// of them
+type probeInstance struct {
+	name   string
+	server *servers.Server
+	fip    *floatingips.FloatingIP
+	// ip is the address the instance is reached with, privateIP the one it
+	// is reached with from the other instances
+	ip        string
+	privateIP string
+	hostKeys  []ssh.PublicKey
+}
+
+// instanceGroup holds the servers booted by bootInstances along with what is
+// needed to reach them
+type instanceGroup struct {
+	computeClient *gophercloud.ServiceClient
+	instances     []*probeInstance
+	privateKey    *rsa.PrivateKey
+}
+
+// address returns the address to SSH into instance
+func (g *instanceGroup) address(r *probeRun, instance *probeInstance) string {
+	return net.JoinHostPort(instance.ip, strconv.Itoa(r.module.SSHPort))
+}
+
+// dial connects over SSH to instance
+func (g *instanceGroup) dial(ctx context.Context, r *probeRun, instance *probeInstance) (*ssh.Client, error) {
+	config, err := sshClientConfig(r.module.User, instance.hostKeys, *g.privateKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sshDial(ctx, g.address(r, instance), config)
+}
+
+// bootInstances boots a server for each name, on different hypervisors as far
+// as the server group policy of the module allows, and waits until they are
+// all reachable over SSH like spawnInstance does. Besides SSH, the security
+// group of the servers allows the rules returned by extraRules for its ID.
+func bootInstances(ctx context.Context, r *probeRun, provider *gophercloud.ProviderClient, resourceName string, names []string, extraRules func(securityGroupID string) []rules.CreateOpts) (*instanceGroup, error) {
+	res, err := findBootResources(ctx, r, provider)
+
+	if err != nil {
+		return nil, err
+	}
+
+	securityGroup, err := createSecurityGroup(ctx, r, res.networkClient, resourceName, extraRules)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.step(ctx, "security_group_rules_created"); err != nil {
+		return nil, err
+	}
+
+	keypair, privateKey, err := uploadSSHKey(ctx, r, res.computeClient, resourceName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The soft anti-affinity policy needs the compute API microversion 2.15
+
+	groupClient := *res.computeClient
+
+	if r.module.ServerGroupPolicy == serverGroupPolicySoftAntiAffinity {
+		groupClient.Microversion = "2.15"
+	}
+
+	serverGroup, err := servergroups.Create(&groupClient, servergroups.CreateOpts{
+		Name:     resourceName,
+		Policies: []string{r.module.ServerGroupPolicy},
+	}).Extract()
+
+	if err != nil {
+		return nil, fmt.Errorf("server group failure: %w", err)
+	}
+
+	if err := r.step(ctx, "server_group_created"); err != nil {
+		return nil, err
+	}
+
+	g := &instanceGroup{computeClient: res.computeClient, privateKey: privateKey}
+
+	for _, name := range names {
+		g.instances = append(g.instances, &probeInstance{name: name})
+	}
+
+	// Create a floating IP for each server, unless they are reached on their
+	// IPv6 address
+
+	if r.module.AddressFamily != addressFamilyIPv6 {
+		fips, err := createFloatingIPs(ctx, r, res.networkClient, resourceName, len(g.instances))
+
+		if err != nil {
+			return nil, err
+		}
+
+		for i, instance := range g.instances {
+			instance.fip = fips[i]
+		}
+
+		if err := r.step(ctx, "floating_ips_created"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Boot the servers, the boot volumes of each one having its own steps
+
+	for _, instance := range g.instances {
+		serverOpts := servers.CreateOpts{
+			Name:           resourceName + "-" + instance.name,
+			FlavorRef:      res.flavor.ID,
+			Networks:       []servers.Network{servers.Network{UUID: res.network.ID}},
+			SecurityGroups: []string{securityGroup.ID},
+		}
+
+		instance.server, err = bootServer(ctx, r, provider, res, serverOpts, keypair.Name, serverGroup.ID, "boot_"+instance.name+"_")
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.step(ctx, "servers_created"); err != nil {
+		return nil, err
+	}
+
+	for _, instance := range g.instances {
+		instance.server, err = waitServer(ctx, res.computeClient, instance.server.ID)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.step(ctx, "servers_active_status"); err != nil {
+		return nil, err
+	}
+
+	// Find the addresses to reach the servers with, over IPv6 the servers
+	// reach each other on the same address
+
+	for _, instance := range g.instances {
+		ip, port, err := serverAddress(r, res.networkClient, instance.server.ID, instance.fip)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(port.FixedIPs) == 0 {
+			return nil, fmt.Errorf("server %s has no private address", instance.server.ID)
+		}
+
+		instance.ip = ip
+		instance.privateIP = port.FixedIPs[0].IPAddress
+
+		if r.module.AddressFamily == addressFamilyIPv6 {
+			instance.privateIP = ip
+		}
+	}
+
+	if err := r.step(ctx, r.module.addressStep()); err != nil {
+		return nil, err
+	}
+
+	// Retrieve the host keys and SSH into the servers
+
+	for _, instance := range g.instances {
+		instance.hostKeys, err = getHostKey(ctx, res.computeClient, *instance.server, r)
+
+		if err != nil {
+			log.Printf("host key: %s\n", err)
+		}
+	}
+
+	if err := r.step(ctx, "ssh_host_keys_retrieved"); err != nil {
+		return nil, err
+	}
+
+	for _, instance := range g.instances {
+		if err := sshServer(ctx, g.address(r, instance), r.module.User, instance.hostKeys, *privateKey); err != nil {
+			return nil, fmt.Errorf("SSH connection to server %s failed: %w", instance.name, err)
+		}
+	}
+
+	if err := r.step(ctx, "ssh_successful"); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
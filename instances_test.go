@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBootInstances(t *testing.T) {
+	tests := []struct {
+		bootMode string
+		policy   string
+		// volumes is the number of volumes created by the probe
+		volumes int
+		// sourceType is the source of the block device of the servers
+		sourceType string
+	}{
+		{bootMode: bootModeVolume, policy: serverGroupPolicyAntiAffinity, volumes: 2, sourceType: "volume"},
+		{bootMode: bootModeImage, policy: serverGroupPolicySoftAntiAffinity},
+		{bootMode: bootModeImageVolume, policy: serverGroupPolicyAntiAffinity, sourceType: "image"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.bootMode, func(t *testing.T) {
+			f, s, module := newSpawnFixture(t, "east_west")
+
+			s.exec = func(command string) (string, uint32) {
+				if command == "/usr/bin/whoami" {
+					return "ubuntu\n", 0
+				}
+
+				return "5 packets transmitted, 5 received, 0% packet loss, time 4005ms\n", 0
+			}
+
+			module.BootMode = test.bootMode
+			module.ServerGroupPolicy = test.policy
+
+			result := runTestProbe(t, module, f.cloud())
+
+			if !result.success {
+				t.Fatalf("got %+v, want success", result)
+			}
+
+			if len(f.volumes.objects) != test.volumes {
+				t.Errorf("got %d volumes, want %d", len(f.volumes.objects), test.volumes)
+			}
+
+			for _, server := range f.servers.list() {
+				sourceType := ""
+
+				if devices, ok := server["block_device_mapping_v2"].([]interface{}); ok {
+					sourceType, _ = devices[0].(map[string]interface{})["source_type"].(string)
+				}
+
+				if sourceType != test.sourceType {
+					t.Errorf("got block device source %q, want %q", sourceType, test.sourceType)
+				}
+
+				if imageRef, _ := server["imageRef"].(string); (imageRef != "") != (test.bootMode == bootModeImage) {
+					t.Errorf("unexpected image reference %q", imageRef)
+				}
+			}
+
+			if policies := f.serverGroups.list()[0]["policies"]; len(policies.([]interface{})) != 1 || policies.([]interface{})[0] != test.policy {
+				t.Errorf("got server group policies %v, want %s", policies, test.policy)
+			}
+		})
+	}
+}
+
+func TestBootInstancesIPv6(t *testing.T) {
+	f, _, module := newSpawnFixture(t, "east_west")
+
+	f.ipv6Address = "2001:db8::10"
+
+	module.AddressFamily = addressFamilyIPv6
+	module.Timeout = 2 * time.Second
+
+	// The documentation address of the servers cannot be reached
+	result := runTestProbe(t, module, f.cloud())
+
+	if result.success || result.step != "ssh_host_keys_retrieved" {
+		t.Errorf("got %+v, want failure after step ssh_host_keys_retrieved", result)
+	}
+
+	if len(f.floatingIPs.objects) != 0 {
+		t.Errorf("floating IPs created: %v", f.floatingIPs.list())
+	}
+
+	for _, rule := range f.rules.list() {
+		if rule["ethertype"] != "IPv6" {
+			t.Errorf("got security group rule %v, want an IPv6 one", rule)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/startstop"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ssh"
+)
+
+// Lifecycle actions of the spawn probe
+const (
+	actionSoftReboot = "soft_reboot"
+	actionStopStart  = "stop_start"
+	actionResize     = "resize"
+)
+
+// lifecycleAction is a server action made of one or more API calls
+type lifecycleAction struct {
+	name  string
+	calls []lifecycleCall
+}
+
+// lifecycleCall is an API call after which the server reaches status, the
+// step being recorded then
+type lifecycleCall struct {
+	call   func() error
+	status string
+	step   string
+}
+
+// runLifecycle performs a soft reboot, a stop and start, and a resize to the
+// resize flavor of the module when set, on the server reachable over SSH to
+// address. The instance must be reachable over SSH again after each action, and
+// the duration of each action is exported.
+func runLifecycle(ctx context.Context, r *probeRun, computeClient *gophercloud.ServiceClient, serverID string, address string, hostKeys []ssh.PublicKey, privateKey rsa.PrivateKey) error {
+	duration := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   program + "_" + r.module.Prober,
+		Name:        "lifecycle_duration_seconds",
+		Help:        "Duration of the lifecycle action until the instance was reachable over SSH again",
+		ConstLabels: r.labels,
+	},
+		[]string{"action"},
+	)
+
+	r.registry.MustRegister(duration)
+
+	actions := []lifecycleAction{
+		{
+			name: actionSoftReboot,
+			calls: []lifecycleCall{{
+				call: func() error {
+					return servers.Reboot(computeClient, serverID, servers.RebootOpts{Type: servers.SoftReboot}).ExtractErr()
+				},
+				status: "ACTIVE",
+				step:   "soft_reboot_active_status",
+			}},
+		},
+		{
+			name: actionStopStart,
+			calls: []lifecycleCall{
+				{
+					call: func() error {
+						return startstop.Stop(computeClient, serverID).ExtractErr()
+					},
+					status: "SHUTOFF",
+					step:   "stop_shutoff_status",
+				},
+				{
+					call: func() error {
+						return startstop.Start(computeClient, serverID).ExtractErr()
+					},
+					status: "ACTIVE",
+					step:   "start_active_status",
+				},
+			},
+		},
+	}
+
+	if r.module.ResizeFlavor != "" {
+		flavor, err := getFlavor(computeClient, r.module.ResizeFlavor)
+
+		if err != nil {
+			return fmt.Errorf("resize flavor not found: %w", err)
+		}
+
+		actions = append(actions, lifecycleAction{
+			name: actionResize,
+			calls: []lifecycleCall{
+				{
+					call: func() error {
+						return servers.Resize(computeClient, serverID, servers.ResizeOpts{FlavorRef: flavor.ID}).ExtractErr()
+					},
+					status: "VERIFY_RESIZE",
+					step:   "resize_verify_resize_status",
+				},
+				{
+					call: func() error {
+						return servers.ConfirmResize(computeClient, serverID).ExtractErr()
+					},
+					status: "ACTIVE",
+					step:   "resize_confirm_active_status",
+				},
+			},
+		})
+	}
+
+	for _, action := range actions {
+		start := time.Now()
+
+		for _, call := range action.calls {
+			if err := call.call(); err != nil {
+				return fmt.Errorf("%s failed: %w", action.name, err)
+			}
+
+			if _, err := waitServerStatus(ctx, computeClient, serverID, call.status); err != nil {
+				return err
+			}
+
+			if err := r.step(ctx, call.step); err != nil {
+				return err
+			}
+		}
+
+		if err := sshServer(ctx, address, r.module.User, hostKeys, privateKey); err != nil {
+			return fmt.Errorf("SSH connection after %s failed: %w", action.name, err)
+		}
+
+		if err := r.step(ctx, action.name+"_ssh_successful"); err != nil {
+			return err
+		}
+
+		duration.WithLabelValues(action.name).Set(time.Since(start).Seconds())
+
+		log.Printf("Server %s reachable after %s", serverID, action.name)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSpawnLifecycle(t *testing.T) {
+	tests := []struct {
+		name         string
+		resizeFlavor string
+		setup        func(f *fakeCloud)
+		actions      []string
+		reason       string
+		step         string
+	}{
+		{
+			name:    "without resize",
+			actions: []string{"reboot", "os-stop", "os-start"},
+		},
+		{
+			name:         "with resize",
+			resizeFlavor: "m1.small",
+			actions:      []string{"reboot", "os-stop", "os-start", "resize", "confirmResize"},
+		},
+		{
+			name:         "resize in error",
+			resizeFlavor: "m1.small",
+			setup: func(f *fakeCloud) {
+				f.actionStatuses["resize"] = "ERROR"
+			},
+			reason: reasonResourceError,
+			step:   "stop_start_ssh_successful",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, _, module := newSpawnFixture(t, "spawn")
+			f.flavors.objects["flavor-2"] = fakeObject{"id": "flavor-2", "name": "m1.small", "ram": 2048, "vcpus": 1, "disk": 20}
+
+			module.Lifecycle = true
+			module.ResizeFlavor = test.resizeFlavor
+
+			if test.setup != nil {
+				test.setup(f)
+			}
+
+			result := runTestProbe(t, module, f.cloud())
+
+			if test.reason != "" {
+				if result.success || result.reason != test.reason || result.step != test.step {
+					t.Errorf("got %+v, want failure with reason %s after step %s", result, test.reason, test.step)
+				}
+
+				return
+			}
+
+			if !result.success {
+				t.Fatalf("got %+v, want success", result)
+			}
+
+			if !reflect.DeepEqual(f.actions, test.actions) {
+				t.Errorf("got actions %v, want %v", f.actions, test.actions)
+			}
+
+			for _, action := range []string{actionSoftReboot, actionStopStart, actionResize} {
+				_, ok := result.value(t, "openstack_client_spawn_lifecycle_duration_seconds", map[string]string{"action": action})
+
+				if want := action != actionResize || test.resizeFlavor != ""; ok != want {
+					t.Errorf("action %s: got duration %v, want %v", action, ok, want)
+				}
+			}
+
+			if flavor := f.servers.list()[0]["flavor"]; test.resizeFlavor != "" && !reflect.DeepEqual(flavor, fakeObject{"id": "flavor-2"}) {
+				t.Errorf("got flavor %v, want flavor-2", flavor)
+			}
+		})
+	}
+}
@@ -6,9 +6,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/prometheus/common/version"
@@ -16,7 +15,6 @@ import (
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/acceptance/tools"
 	"github.com/gophercloud/gophercloud/openstack"
-	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -35,80 +33,83 @@ var (
 	internalNetwork string
 	externalNetwork string
 	userName        string
+	enabledProbes   string
+	configFile      string
 )
 
-func metricsHandler(w http.ResponseWriter, r *http.Request) {
-	registry := prometheus.NewRegistry()
+func metricsHandler(registry *prometheus.Registry, s *scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Probes without an interval are run now, the others are run in the
+		// background by the scheduler and only their cached results are served
+		s.refresh(r.Context())
 
-	registry.MustRegister(version.NewCollector("openstack_client_exporter"))
-	registry.MustRegister(prometheus.NewGoCollector())
+		gatherers := append(prometheus.Gatherers{registry}, s.gatherers()...)
+
+		promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
+
+// probeHandler runs a single probe against one of the configured clouds, in the
+// style of the blackbox exporter: /probe?cloud=<name>&module=<probe>
+func probeHandler(s *scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cloud, err := getCloud(r.URL.Query().Get("cloud"))
 
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
-	defer cancel()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	wg := sync.WaitGroup{}
+		moduleName := r.URL.Query().Get("module")
+		module, ok := getModule(moduleName)
 
-	// Spawn a server and ssh into it
-	wg.Add(1)
-	go func() {
-		start := time.Now()
-		spawnMain(ctx, registry)
-		wg.Done()
-		log.Printf("spawnMain finished in %v", time.Since(start))
-	}()
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown module %q", moduleName), http.StatusBadRequest)
+			return
+		}
 
-	// Upload and download a file from the object store
-	wg.Add(1)
-	go func() {
-		start := time.Now()
-		objectStoreMain(ctx, registry)
-		wg.Done()
-		log.Printf("objectStoreMain finished in %v", time.Since(start))
-	}()
+		registry := s.probeTarget(r.Context(), cloud, module)
 
-	wg.Wait()
+		if registry == nil {
+			http.Error(w, "probe did not complete", http.StatusServiceUnavailable)
+			return
+		}
 
-	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
 }
 
-func getProvider(ctx context.Context) (*gophercloud.ProviderClient, error) {
-	opts := tokens.AuthOptions{
-		Username:   os.Getenv("OS_USERNAME"),
-		DomainName: os.Getenv("OS_USER_DOMAIN_NAME"),
-		Password:   os.Getenv("OS_PASSWORD"),
-		Scope: tokens.Scope{
-			ProjectName: os.Getenv("OS_PROJECT_NAME"),
-			DomainName:  os.Getenv("OS_PROJECT_DOMAIN_NAME"),
-		},
+func getProvider(ctx context.Context, cloud *cloudConfig) (*gophercloud.ProviderClient, error) {
+	opts, err := cloud.authOptions()
+
+	if err != nil {
+		return nil, withReason(reasonAuth, fmt.Errorf("authentication failure: %w", err))
 	}
 
-	provider, err := openstack.NewClient(os.Getenv("OS_AUTH_URL"))
+	provider, err := openstack.NewClient(cloud.Auth.AuthURL)
 
 	if err != nil {
-		return nil, fmt.Errorf("cannot create OpenStack client: %s", err)
+		return nil, fmt.Errorf("cannot create OpenStack client: %w", err)
 	}
 
 	// Progate our current context, this helps cleaning up resources in case of timeout
 	provider.Context = ctx
 
-	err = openstack.AuthenticateV3(provider, &opts, gophercloud.EndpointOpts{})
+	err = openstack.AuthenticateV3(provider, opts, gophercloud.EndpointOpts{})
 
 	if err != nil {
-		return nil, fmt.Errorf("authentication failure: %s", err)
-	}
+		err = fmt.Errorf("authentication failure: %w", err)
 
-	return provider, err
-}
+		// Errors coming neither from the API nor from the network are caused
+		// by missing or inconsistent credentials
+		if classifyError(ctx, err) == reasonUnknown {
+			err = withReason(reasonAuth, err)
+		}
 
-func step(ctx context.Context, timing prometheus.GaugeVec, name string) error {
-	timing.With(prometheus.Labels{"step": name}).SetToCurrentTime()
-
-	select {
-	case <-ctx.Done():
-		return fmt.Errorf("timeout after %s", name)
-	default:
-		return nil
+		return nil, err
 	}
+
+	return provider, err
 }
 
 func createName() string {
@@ -124,22 +125,73 @@ func main() {
 
 	// Command line configuration flags
 
-	flag.DurationVar(&requestTimeout, "timeout", 59*time.Second, "maximum timeout for a request")
+	flag.DurationVar(&requestTimeout, "timeout", 59*time.Second, "maximum duration of a probe run")
 	flag.StringVar(&flavorName, "flavor", "t2.small", "name of the instance flavor")
 	flag.StringVar(&imageName, "image", "ubuntu-16.04-x86_64", "name of the image")
 	flag.StringVar(&internalNetwork, "internal-network", "private", "name of the internal network")
 	flag.StringVar(&externalNetwork, "external-network", "internet", "name of the external network")
 	flag.StringVar(&userName, "user", "ubuntu", "username used for sshing into the instance")
+	flag.StringVar(&configFile, "config", "", "path of the configuration file defining clouds and modules")
+	flag.StringVar(&enabledProbes, "probes", strings.Join(defaultProbeNames(), ","), "comma separated list of the probes or modules run for /metrics")
 
 	flag.Parse()
 
+	if configFile != "" {
+		c, err := loadConfig(configFile)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		configuration = c
+	}
+
+	modules, err := getModules(enabledProbes)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defaultCloud, err = envCloud()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Launch our garbage collector in its own goroutine
 
 	go runGarbageCollector()
 
+	// Run probes in the background, each one on its own interval
+
+	// Probes served on /metrics are run against the cloud described by
+	// OS_CLOUD and the OS_* environment variables
+
+	var scheduledProbes []*scheduledProbe
+
+	for _, module := range modules {
+		scheduledProbes = append(scheduledProbes, newScheduledProbe(module, defaultCloud, *module.Interval))
+	}
+
+	s := newScheduler(scheduledProbes...)
+	s.start()
+
+	// This registry lives as long as the exporter, it holds the metrics kept
+	// across runs while the ones of each run are in their own registry
+
+	registry := prometheus.NewRegistry()
+
+	registry.MustRegister(version.NewCollector("openstack_client_exporter"))
+	registry.MustRegister(prometheus.NewGoCollector())
+	registry.MustRegister(s)
+	registry.MustRegister(stepDurations)
+	registry.MustRegister(stats)
+
 	// Handle prometheus metric requests
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/metrics", metricsHandler(registry, s))
+	mux.HandleFunc("/probe", probeHandler(s))
+	mux.HandleFunc("/debug/errors", debugErrorsHandler)
 	log.Fatal(http.ListenAndServe("127.0.0.1:9539", mux))
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// setTestConfiguration replaces the configuration for the duration of the test
+func setTestConfiguration(t *testing.T, c *config) {
+	previous := configuration
+	configuration = c
+
+	t.Cleanup(func() { configuration = previous })
+}
+
+// probeRequest serves a /probe request for cloud and module
+func probeRequest(ctx context.Context, s *scheduler, cloud string, module string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/probe?cloud="+cloud+"&module="+module, nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	probeHandler(s)(w, r)
+
+	return w
+}
+
+func TestProbeHandler(t *testing.T) {
+	cloudsTestDir(t)
+
+	f, _, module := newSpawnFixture(t, "spawn")
+	cloud := f.cloud()
+
+	setTestConfiguration(t, &config{
+		Clouds:  map[string]*cloudConfig{cloud.name: cloud},
+		Modules: map[string]*moduleConfig{"spawn": module, "blocking": testModule("blocking")},
+	})
+
+	t.Run("unknown cloud", func(t *testing.T) {
+		if w := probeRequest(context.Background(), newScheduler(), "other", "spawn"); w.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("unknown module", func(t *testing.T) {
+		if w := probeRequest(context.Background(), newScheduler(), cloud.name, "other"); w.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("no completed run", func(t *testing.T) {
+		testProbe.reset()
+		defer close(testProbe.release)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if w := probeRequest(ctx, newScheduler(), cloud.name, "blocking"); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusServiceUnavailable)
+		}
+
+		<-testProbe.started
+	})
+
+	t.Run("cloud label", func(t *testing.T) {
+		w := probeRequest(context.Background(), newScheduler(), cloud.name, "spawn")
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+		}
+
+		want := `openstack_client_spawn_success{cloud="fake",reason="",step=""} 1`
+
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("no %s in:\n%s", want, w.Body.String())
+		}
+	})
+
+	t.Run("concurrent requests", func(t *testing.T) {
+		testProbe.reset()
+		s := newScheduler()
+
+		const requests = 5
+		codes := make(chan int, requests)
+		wg := sync.WaitGroup{}
+
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				codes <- probeRequest(context.Background(), s, cloud.name, "blocking").Code
+			}()
+		}
+
+		<-testProbe.started
+
+		// Release the run once every other request joined it
+		deadline := time.Now().Add(5 * time.Second)
+
+		for testutil.ToFloat64(s.coalesced.WithLabelValues(cloud.name, "blocking")) != requests-1 {
+			if time.Now().After(deadline) {
+				t.Fatal("the requests did not join the run in flight")
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		close(testProbe.release)
+		wg.Wait()
+		close(codes)
+
+		for code := range codes {
+			if code != http.StatusOK {
+				t.Errorf("got status %d, want %d", code, http.StatusOK)
+			}
+		}
+
+		if runs := testProbe.runCount(); runs != 1 {
+			t.Errorf("got %d runs, want 1", runs)
+		}
+	})
+}
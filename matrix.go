@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// variantLabels are the labels distinguishing the runs of the variants of a
+// module, in the order of the values returned by variant
+var variantLabels = []string{"availability_zone", "image", "flavor"}
+
+var (
+	// rotations holds by cloud and module the index of the first variant of
+	// the next run of the modules running their variants in rotation
+	rotationsMutex sync.Mutex
+	rotations      = map[string]int{}
+)
+
+// hasVariants tells whether the module is run once per availability zone,
+// image or flavor rather than once
+func (m *moduleConfig) hasVariants() bool {
+	return m.DiscoverAvailabilityZones || len(m.AvailabilityZones) > 0 || len(m.Images) > 0 || len(m.Flavors) > 0
+}
+
+// variant returns the values of the variantLabels of a run of the module, the
+// image and flavor being only set when the module lists several of them
+func (m *moduleConfig) variant() []string {
+	var image, flavor string
+
+	if len(m.Images) > 0 {
+		image = m.Image
+	}
+
+	if len(m.Flavors) > 0 {
+		flavor = m.Flavor
+	}
+
+	return []string{m.availabilityZone, image, flavor}
+}
+
+// variants returns a copy of the module for each combination of availability
+// zone, image and flavor it is run with, in a stable order for the rotation
+func (m *moduleConfig) variants(ctx context.Context, cloud *cloudConfig) ([]*moduleConfig, error) {
+	zones := []string{""}
+
+	if m.DiscoverAvailabilityZones || len(m.AvailabilityZones) > 0 {
+		var err error
+
+		if zones, err = availabilityZones(ctx, cloud, m); err != nil {
+			return nil, err
+		}
+	}
+
+	images := m.Images
+
+	if len(images) == 0 {
+		images = []string{m.Image}
+	}
+
+	flavors := m.Flavors
+
+	if len(flavors) == 0 {
+		flavors = []string{m.Flavor}
+	}
+
+	var variants []*moduleConfig
+
+	for _, zone := range zones {
+		for _, image := range images {
+			for _, flavor := range flavors {
+				variant := *m
+				variant.availabilityZone = zone
+				variant.Image = image
+				variant.Flavor = flavor
+
+				variants = append(variants, &variant)
+			}
+		}
+	}
+
+	return variants, nil
+}
+
+// rotate returns the variants of the module to run against cloud: all of them
+// when its concurrency is 0 or covers them, or else the next concurrency ones,
+// each run starting where the previous one stopped
+func (m *moduleConfig) rotate(cloud *cloudConfig, variants []*moduleConfig) []*moduleConfig {
+	if m.Concurrency == 0 || m.Concurrency >= len(variants) {
+		return variants
+	}
+
+	rotationsMutex.Lock()
+	defer rotationsMutex.Unlock()
+
+	key := cloud.name + "/" + m.name
+	next := rotations[key] % len(variants)
+	rotations[key] = (next + m.Concurrency) % len(variants)
+
+	selected := make([]*moduleConfig, 0, m.Concurrency)
+
+	for i := 0; i < m.Concurrency; i++ {
+		selected = append(selected, variants[(next+i)%len(variants)])
+	}
+
+	return selected
+}
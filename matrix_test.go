@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSpawnMatrix(t *testing.T) {
+	f, _, module := newSpawnFixture(t, "spawn")
+	f.flavors.objects["flavor-2"] = fakeObject{"id": "flavor-2", "name": "m1.small", "ram": 2048, "vcpus": 1, "disk": 20}
+
+	module.Images = []string{"cirros", "broken"}
+	module.Flavors = []string{"m1.tiny", "m1.small"}
+
+	if err := module.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runTestProbe(t, module, f.cloud())
+
+	for _, image := range module.Images {
+		for _, flavor := range module.Flavors {
+			labels := map[string]string{"image": image, "flavor": flavor}
+			want := 0.0
+
+			if image == "cirros" {
+				want = 1
+			}
+
+			if value, ok := result.value(t, "openstack_client_spawn_success", labels); !ok || value != want {
+				t.Errorf("%s/%s: got success %v (%v), want %v", image, flavor, value, ok, want)
+			}
+		}
+	}
+
+	flavors := map[interface{}]bool{}
+
+	for _, server := range f.servers.list() {
+		flavors[server["flavorRef"]] = true
+	}
+
+	if len(f.servers.objects) != 2 || !flavors["flavor-1"] || !flavors["flavor-2"] {
+		t.Errorf("got servers %v, want one per flavor", f.servers.list())
+	}
+}
+
+func TestSpawnMatrixRotation(t *testing.T) {
+	f, _, module := newSpawnFixture(t, "spawn")
+	f.flavors.objects["flavor-2"] = fakeObject{"id": "flavor-2", "name": "m1.small", "ram": 2048, "vcpus": 1, "disk": 20}
+
+	module.Images = []string{"cirros"}
+	module.Flavors = []string{"m1.tiny", "m1.small"}
+	module.Concurrency = 1
+
+	if err := module.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	cloud := f.cloud()
+	key := cloud.name + "/" + module.name
+
+	rotationsMutex.Lock()
+	delete(rotations, key)
+	rotationsMutex.Unlock()
+
+	// Each run only runs the next flavor, wrapping around after the last one
+	for i, flavor := range []string{"m1.tiny", "m1.small", "m1.tiny"} {
+		result := runTestProbe(t, module, cloud)
+
+		for _, other := range module.Flavors {
+			labels := map[string]string{"image": "cirros", "flavor": other}
+			_, ok := result.value(t, "openstack_client_spawn_success", labels)
+
+			if ok != (other == flavor) {
+				t.Errorf("run %d: got %s run %v, want %v", i, other, ok, other == flavor)
+			}
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	module := testModule("spawn")
+	module.Concurrency = 3
+
+	cloud := &cloudConfig{name: "rotate"}
+	variants := []*moduleConfig{{Image: "a"}, {Image: "b"}, {Image: "c"}, {Image: "d"}}
+
+	for _, want := range []string{"abc", "dab", "cda", "bcd"} {
+		got := ""
+
+		for _, variant := range module.rotate(cloud, variants) {
+			got += variant.Image
+		}
+
+		if got != want {
+			t.Errorf("got variants %s, want %s", got, want)
+		}
+	}
+
+	module.Concurrency = 0
+
+	if got := module.rotate(cloud, variants); len(got) != len(variants) {
+		t.Errorf("got %d variants without concurrency, want all %d", len(got), len(variants))
+	}
+}
+
+func TestMatrixValidation(t *testing.T) {
+	module := testModule("object_store")
+	module.Images = []string{"cirros"}
+
+	if err := module.validate(); err == nil {
+		t.Error("got no error for images on the object_store prober")
+	}
+}
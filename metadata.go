@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ssh"
+)
+
+// Sources of the instance metadata
+const (
+	metadataService = "metadata_service"
+	configDrive     = "config_drive"
+)
+
+// metadataCommands read meta_data.json from each source, they need curl or
+// wget for the metadata service and sudo to mount the config drive
+var metadataCommands = map[string]string{
+	metadataService: "curl -sf http://169.254.169.254/openstack/latest/meta_data.json || wget -qO- http://169.254.169.254/openstack/latest/meta_data.json",
+	configDrive:     "sudo sh -c 'mkdir -p /mnt/config-2 && (mountpoint -q /mnt/config-2 || mount -o ro /dev/disk/by-label/config-2 /mnt/config-2) && cat /mnt/config-2/openstack/latest/meta_data.json'",
+}
+
+// instanceMetadata holds the fields of meta_data.json checked by the probe
+type instanceMetadata struct {
+	UUID       string            `json:"uuid"`
+	Name       string            `json:"name"`
+	Hostname   string            `json:"hostname"`
+	PublicKeys map[string]string `json:"public_keys"`
+}
+
+// check compares the metadata seen by the instance with the server created,
+// Nova derives the hostname from the server name in lower case
+func (m *instanceMetadata) check(serverID string, serverName string, keyName string, publicKey string) error {
+	if m.UUID != serverID {
+		return fmt.Errorf("got instance ID %q, want %q", m.UUID, serverID)
+	}
+
+	if hostname := strings.Split(m.Hostname, ".")[0]; hostname != strings.ToLower(serverName) {
+		return fmt.Errorf("got hostname %q, want %q", m.Hostname, strings.ToLower(serverName))
+	}
+
+	if key := m.PublicKeys[keyName]; strings.TrimSpace(key) != strings.TrimSpace(publicKey) {
+		return fmt.Errorf("got public key %q for keypair %s, want %q", key, keyName, publicKey)
+	}
+
+	return nil
+}
+
+// checkMetadata reads the metadata of the instance from the metadata service
+// and from the config drive, as enabled by the module, over SSH to address. It
+// exports the success and latency of each source and fails if any source is
+// unreachable or inconsistent with the server created.
+func checkMetadata(ctx context.Context, r *probeRun, address string, config *ssh.ClientConfig, serverID string, serverName string, keyName string, publicKey string) error {
+	namespace := program + "_" + r.module.Prober
+
+	success := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "metadata_success",
+		Help:        "'1' if the instance read metadata matching the server from the source",
+		ConstLabels: r.labels,
+	},
+		[]string{"source"},
+	)
+
+	duration := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "metadata_duration_seconds",
+		Help:        "Duration of the read of the metadata from the source by the instance",
+		ConstLabels: r.labels,
+	},
+		[]string{"source"},
+	)
+
+	r.registry.MustRegister(success)
+	r.registry.MustRegister(duration)
+
+	var sources []string
+
+	if r.module.Metadata {
+		sources = append(sources, metadataService)
+	}
+
+	if r.module.ConfigDrive {
+		sources = append(sources, configDrive)
+	}
+
+	client, err := sshDial(ctx, address, config)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	var failed []string
+
+	for _, source := range sources {
+		start := time.Now()
+		stdout, code, err := runCommand(client, metadataCommands[source])
+		duration.WithLabelValues(source).Set(time.Since(start).Seconds())
+
+		if ctx.Err() != nil {
+			return withReason(reasonTimeout, fmt.Errorf("timeout while reading metadata from %s", source))
+		}
+
+		if err == nil && code != 0 {
+			err = fmt.Errorf("exit code %d", code)
+		}
+
+		if err == nil {
+			var metadata instanceMetadata
+
+			if err = json.Unmarshal([]byte(stdout), &metadata); err == nil {
+				err = metadata.check(serverID, serverName, keyName, publicKey)
+			}
+		}
+
+		if err != nil {
+			log.Printf("metadata from %s: %s", source, err)
+			success.WithLabelValues(source).Set(0)
+			failed = append(failed, source)
+			continue
+		}
+
+		success.WithLabelValues(source).Set(1)
+	}
+
+	if len(failed) > 0 {
+		return withReason(reasonMetadata, fmt.Errorf("metadata check failed: %s", strings.Join(failed, ", ")))
+	}
+
+	return nil
+}
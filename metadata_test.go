@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSpawnMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		// metadata returns the metadata served by each source
+		metadata func(expected instanceMetadata) map[string]*instanceMetadata
+		success  map[string]float64
+	}{
+		{
+			name: "consistent",
+			metadata: func(expected instanceMetadata) map[string]*instanceMetadata {
+				return map[string]*instanceMetadata{metadataService: &expected, configDrive: &expected}
+			},
+			success: map[string]float64{metadataService: 1, configDrive: 1},
+		},
+		{
+			name: "metadata service unreachable",
+			metadata: func(expected instanceMetadata) map[string]*instanceMetadata {
+				return map[string]*instanceMetadata{configDrive: &expected}
+			},
+			success: map[string]float64{metadataService: 0, configDrive: 1},
+		},
+		{
+			name: "wrong instance ID on config drive",
+			metadata: func(expected instanceMetadata) map[string]*instanceMetadata {
+				wrong := expected
+				wrong.UUID = "other"
+
+				return map[string]*instanceMetadata{metadataService: &expected, configDrive: &wrong}
+			},
+			success: map[string]float64{metadataService: 1, configDrive: 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, s, module := newSpawnFixture(t, "spawn")
+
+			s.exec = func(command string) (string, uint32) {
+				if command == "/usr/bin/whoami" {
+					return "ubuntu\n", 0
+				}
+
+				f.mutex.Lock()
+				defer f.mutex.Unlock()
+
+				server := f.servers.list()[0]
+				keypair := f.keypairs.list()[0]
+				name := server["name"].(string)
+
+				expected := instanceMetadata{
+					UUID:       server["id"].(string),
+					Name:       name,
+					Hostname:   strings.ToLower(name) + ".novalocal",
+					PublicKeys: map[string]string{keypair["name"].(string): keypair["public_key"].(string)},
+				}
+
+				for source, metadata := range test.metadata(expected) {
+					if command == metadataCommands[source] {
+						content, _ := json.Marshal(metadata)
+						return string(content), 0
+					}
+				}
+
+				return "", 1
+			}
+
+			module.Metadata = true
+			module.ConfigDrive = true
+
+			result := runTestProbe(t, module, f.cloud())
+
+			wantSuccess := test.success[metadataService] == 1 && test.success[configDrive] == 1
+
+			switch {
+			case wantSuccess && !result.success:
+				t.Errorf("got %+v, want success", result)
+			case !wantSuccess && (result.success || result.reason != reasonMetadata || result.step != "ssh_successful"):
+				t.Errorf("got %+v, want failure with reason %s after step ssh_successful", result, reasonMetadata)
+			}
+
+			for source, want := range test.success {
+				labels := map[string]string{"source": source}
+
+				if value, ok := result.value(t, "openstack_client_spawn_metadata_success", labels); !ok || value != want {
+					t.Errorf("source %s: got success %v, want %v", source, value, want)
+				}
+
+				if _, ok := result.value(t, "openstack_client_spawn_metadata_duration_seconds", labels); !ok {
+					t.Errorf("source %s: no duration", source)
+				}
+			}
+
+			if configDrive, _ := f.servers.list()[0]["config_drive"].(bool); !configDrive {
+				t.Error("server booted without config drive")
+			}
+		})
+	}
+}
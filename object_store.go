@@ -6,57 +6,36 @@ import (
 	"io"
 	"log"
 	"os"
+	"time"
 
-	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/containers"
 	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/objects"
-	"github.com/prometheus/client_golang/prometheus"
 )
 
-const fileSize int64 = 100 << (10 * 2)
-
-func objectStoreMain(ctx context.Context, registry *prometheus.Registry) {
-	success := prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: program + "_object_store",
-		Name:      "success",
-		Help:      "'1' when a file was successfuly uploaded and downloaded from the object store",
-	},
-		[]string{"error"},
-	)
-
-	timing := prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: program + "_object_store",
-		Name:      "timing",
-		Help:      "Timestamp of each step for uploading and downloadin a file from the object store",
-	},
-		[]string{
-			"step",
-		},
-	)
-
-	registry.MustRegister(success)
-	registry.MustRegister(timing)
-
-	c1 := make(chan error, 1)
-	go func() {
-		c1 <- uploadDownloadFile(ctx, *timing)
-	}()
-
-	select {
-	case err := <-c1:
-		if err != nil {
-			log.Printf("ERROR: %s\n", err)
-			success.WithLabelValues(fmt.Sprintf("%s", err)).Set(0)
-		} else {
-			success.WithLabelValues("").Set(1)
-		}
-	case <-ctx.Done():
-		log.Println("ERROR: request timeout reached")
-		success.WithLabelValues(fmt.Sprintf("request timeout reached")).Set(0)
+const defaultObjectSize int64 = 100 << (10 * 2)
+
+type objectStoreProbe struct{}
+
+func init() {
+	registerProbe(objectStoreProbe{}, 5*time.Minute, true)
+}
+
+func (objectStoreProbe) Name() string {
+	return "object_store"
+}
+
+func (objectStoreProbe) Description() probeDescription {
+	return probeDescription{
+		success: "'1' when a file was successfuly uploaded and downloaded from the object store",
+		timing:  "Timestamp of each step for uploading and downloadin a file from the object store",
 	}
 }
 
+func (objectStoreProbe) Run(ctx context.Context, r *probeRun) error {
+	return uploadDownloadFile(ctx, r)
+}
+
 type zeroes struct {
 	Offset int64
 	Length int64
@@ -92,50 +71,50 @@ func (z *zeroes) Seek(offset int64, whence int) (int64, error) {
 	return z.Offset, nil
 }
 
-func uploadDownloadFile(ctx context.Context, timing prometheus.GaugeVec) error {
-	if err := step(ctx, timing, "start"); err != nil {
+func uploadDownloadFile(ctx context.Context, r *probeRun) error {
+	if err := r.step(ctx, "start"); err != nil {
 		return err
 	}
 
 	resourceName := createName()
 	log.Printf("uploadDownloadFile using resource name %s\n", resourceName)
 
-	provider, err := getProvider(ctx)
+	provider, err := getProvider(ctx, r.cloud)
 
 	if err != nil {
 		return err
 	}
 
-	if err := step(ctx, timing, "auth_ok"); err != nil {
+	if err := r.step(ctx, "auth_ok"); err != nil {
 		return err
 	}
 
-	client, err := openstack.NewObjectStorageV1(provider, gophercloud.EndpointOpts{})
+	client, err := openstack.NewObjectStorageV1(provider, r.cloud.endpointOpts())
 
 	if err != nil {
-		return fmt.Errorf("object store client failure: %s", err)
+		return fmt.Errorf("object store client failure: %w", err)
 	}
 
 	// Create a container
 
 	if _, err := containers.Create(client, resourceName, containers.CreateOpts{}).Extract(); err != nil {
-		return fmt.Errorf("failed to create container: %s", err)
+		return fmt.Errorf("failed to create container: %w", err)
 	}
 
-	if err := step(ctx, timing, "container_created"); err != nil {
+	if err := r.step(ctx, "container_created"); err != nil {
 		return err
 	}
 
 	// Upload a file into our new containe
 	objectOpts := objects.CreateOpts{
-		Content: &zeroes{0, fileSize},
+		Content: &zeroes{0, r.module.ObjectSize},
 	}
 
 	if _, err := objects.Create(client, resourceName, resourceName, objectOpts).Extract(); err != nil {
-		return fmt.Errorf("failed to upload object: %s", err)
+		return fmt.Errorf("failed to upload object: %w", err)
 	}
 
-	if err := step(ctx, timing, "object_uploaded"); err != nil {
+	if err := r.step(ctx, "object_uploaded"); err != nil {
 		return err
 	}
 
@@ -144,7 +123,7 @@ func uploadDownloadFile(ctx context.Context, timing prometheus.GaugeVec) error {
 	downloadResult := objects.Download(client, resourceName, resourceName, objects.DownloadOpts{})
 
 	if _, err := downloadResult.Extract(); err != nil {
-		return fmt.Errorf("download failed: %s", err)
+		return fmt.Errorf("download failed: %w", err)
 	}
 
 	defer downloadResult.Body.Close()
@@ -152,7 +131,7 @@ func uploadDownloadFile(ctx context.Context, timing prometheus.GaugeVec) error {
 	devNull, err := os.Create(os.DevNull)
 
 	if err != nil {
-		return fmt.Errorf("cannot open /dev/null: %s", err)
+		return fmt.Errorf("cannot open /dev/null: %w", err)
 	}
 
 	defer devNull.Close()
@@ -162,36 +141,36 @@ func uploadDownloadFile(ctx context.Context, timing prometheus.GaugeVec) error {
 	written, err := io.Copy(devNull, downloadResult.Body)
 
 	if err != nil {
-		return fmt.Errorf("failed to download object: %s", err)
+		return fmt.Errorf("failed to download object: %w", err)
 	}
 
 	log.Printf("%v bytes written", written)
 
-	if err := step(ctx, timing, "object_downloaded"); err != nil {
+	if err := r.step(ctx, "object_downloaded"); err != nil {
 		return err
 	}
 
 	// Delete object
 
 	if _, err := objects.Delete(client, resourceName, resourceName, objects.DeleteOpts{}).Extract(); err != nil {
-		return fmt.Errorf("failed to delete object")
+		return fmt.Errorf("failed to delete object: %w", err)
 	}
 
-	if err := step(ctx, timing, "object_deleted"); err != nil {
+	if err := r.step(ctx, "object_deleted"); err != nil {
 		return err
 	}
 
 	// Delete container
 
 	if _, err := containers.Delete(client, resourceName).Extract(); err != nil {
-		return fmt.Errorf("failed to delete container: %s", err)
+		return fmt.Errorf("failed to delete container: %w", err)
 	}
 
-	if err := step(ctx, timing, "container_deleted"); err != nil {
+	if err := r.step(ctx, "container_deleted"); err != nil {
 		return err
 	}
 
-	if err := step(ctx, timing, "end"); err != nil {
+	if err := r.step(ctx, "end"); err != nil {
 		return err
 	}
 
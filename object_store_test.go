@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestObjectStore(t *testing.T) {
+	f := newFakeCloud(t)
+
+	result := runTestProbe(t, testModule("object_store"), f.cloud())
+
+	if !result.success {
+		t.Fatalf("got %+v, want success", result)
+	}
+
+	if len(f.containers) != 0 {
+		t.Errorf("containers left behind: %v", sortedKeys(f.containers))
+	}
+}
+
+func TestObjectStoreFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		prefix string
+		status int
+		reason string
+		step   string
+	}{
+		{
+			name:   "container creation refused",
+			method: http.MethodPut,
+			prefix: "/object-store/v1/AUTH_project-1/",
+			status: http.StatusForbidden,
+			reason: reasonForbidden,
+			step:   "auth_ok",
+		},
+		{
+			name:   "download failure",
+			method: http.MethodGet,
+			prefix: "/object-store/v1/AUTH_project-1/",
+			status: http.StatusServiceUnavailable,
+			reason: reasonAPI5xx,
+			step:   "object_uploaded",
+		},
+		{
+			name:   "deletion failure",
+			method: http.MethodDelete,
+			prefix: "/object-store/v1/AUTH_project-1/",
+			status: http.StatusServiceUnavailable,
+			reason: reasonAPI5xx,
+			step:   "object_downloaded",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFakeCloud(t)
+			f.fail(test.method, test.prefix, test.status, "")
+
+			result := runTestProbe(t, testModule("object_store"), f.cloud())
+
+			if result.success || result.reason != test.reason || result.step != test.step {
+				t.Errorf("got %+v, want failure with reason %s after step %s", result, test.reason, test.step)
+			}
+		})
+	}
+}
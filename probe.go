@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Probe is a check performed against OpenStack from the user side
+type Probe interface {
+	// Name identifies the probe in metric names, flags and logs
+	Name() string
+	// Description returns the help texts of the metrics exported by the runner
+	Description() probeDescription
+	// Run performs the check, calling r.step after each successful step
+	Run(ctx context.Context, r *probeRun) error
+}
+
+// probeDescription holds the help texts of the metrics common to every probe
+type probeDescription struct {
+	success string
+	timing  string
+}
+
+// registeredProbe is a probe known to the exporter along with its settings
+type registeredProbe struct {
+	probe Probe
+	// interval is the default interval of the modules using this probe
+	interval time.Duration
+	// enabled tells whether the probe is run for /metrics by default
+	enabled bool
+}
+
+var registeredProbes = map[string]*registeredProbe{}
+
+// stepDurations keeps the duration of each step across runs, unlike the
+// other metrics of a probe which only describe its last run
+var stepDurations = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: program,
+	Name:      "probe_step_duration_seconds",
+	Help:      "Duration of each step of the probes since the previous step",
+	Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+},
+	append(append([]string{"cloud", "probe"}, variantLabels...), "step"),
+)
+
+// registerProbe makes p available to the exporter and defines its command line
+// flags. It is meant to be called from the init function of each probe, probes
+// which are costly or need a specific setup are not enabled by default.
+func registerProbe(p Probe, defaultInterval time.Duration, enabled bool) {
+	name := p.Name()
+
+	if _, exists := registeredProbes[name]; exists {
+		panic(fmt.Sprintf("probe %s registered twice", name))
+	}
+
+	rp := &registeredProbe{probe: p, enabled: enabled}
+	flagName := strings.Replace(name, "_", "-", -1)
+	flag.DurationVar(&rp.interval, flagName+"-interval", defaultInterval, "interval between two runs of the "+name+" probe, 0 to run it on scrape")
+
+	registeredProbes[name] = rp
+}
+
+// probeNames returns the names of all registered probes in a stable order
+func probeNames() []string {
+	names := make([]string, 0, len(registeredProbes))
+
+	for name := range registeredProbes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// defaultProbeNames returns the names of the probes enabled by default
+func defaultProbeNames() []string {
+	var names []string
+
+	for name, rp := range registeredProbes {
+		if rp.enabled {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// probeRun holds the state of a single run of a probe
+type probeRun struct {
+	// cloud is the OpenStack cloud the probe is run against
+	cloud *cloudConfig
+	// module holds the settings of the probe
+	module *moduleConfig
+	// registry receives the metrics of this run, probes may register their
+	// own collectors into it with labels as constant labels
+	registry *prometheus.Registry
+	labels   prometheus.Labels
+	timing   *prometheus.GaugeVec
+	duration *prometheus.GaugeVec
+	elapsed  *prometheus.GaugeVec
+
+	// start is the time at which the run started, last the one at which the
+	// previous step was reached
+	start time.Time
+	last  time.Time
+
+	// lastStep is the name of the last step reached, the runner reads it
+	// while the probe may still be running when the run times out
+	lastStepMutex sync.Mutex
+	lastStep      string
+}
+
+func (r *probeRun) getLastStep() string {
+	r.lastStepMutex.Lock()
+	defer r.lastStepMutex.Unlock()
+
+	return r.lastStep
+}
+
+// step records the time at which the named step was reached along with its
+// duration, and fails if ctx is done
+func (r *probeRun) step(ctx context.Context, name string) error {
+	now := time.Now()
+	duration := now.Sub(r.last).Seconds()
+	r.last = now
+
+	r.timing.With(prometheus.Labels{"step": name}).Set(float64(now.UnixNano()) / 1e9)
+	r.duration.With(prometheus.Labels{"step": name}).Set(duration)
+	r.elapsed.With(prometheus.Labels{"step": name}).Set(now.Sub(r.start).Seconds())
+	labels := append(append([]string{r.cloud.name, r.module.name}, r.module.variant()...), name)
+	stepDurations.WithLabelValues(labels...).Observe(duration)
+
+	r.lastStepMutex.Lock()
+	r.lastStep = name
+	r.lastStepMutex.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return withReason(reasonTimeout, fmt.Errorf("timeout after %s", name))
+	default:
+		return nil
+	}
+}
+
+// runProbe runs module against cloud and records into registry whether it
+// succeeded, the time at which each step was reached and why it failed. The
+// reason and the step after which the run failed are bounded label values,
+// the raw error message is logged and kept for /debug/errors.
+//
+// Modules with variants, in several availability zones or with several images
+// or flavors, run all of them at once, or as many as their concurrency allows
+// in rotation, the results being labelled with the variant. Each variant is
+// bounded by the timeout of the module.
+func runProbe(ctx context.Context, module *moduleConfig, cloud *cloudConfig, registry *prometheus.Registry) {
+	p := registeredProbes[module.Prober].probe
+
+	if !module.hasVariants() {
+		runModule(ctx, module, cloud, registry, p.Run)
+		return
+	}
+
+	discoveryCtx, cancel := context.WithTimeout(ctx, module.Timeout)
+	variants, err := module.variants(discoveryCtx, cloud)
+	cancel()
+
+	if err != nil {
+		// The failure of the discovery is reported as a failed run
+		runModule(ctx, module, cloud, registry, func(ctx context.Context, r *probeRun) error {
+			return err
+		})
+		return
+	}
+
+	wg := sync.WaitGroup{}
+
+	for _, variant := range module.rotate(cloud, variants) {
+		wg.Add(1)
+
+		go func(variant *moduleConfig) {
+			defer wg.Done()
+			runModule(ctx, variant, cloud, registry, p.Run)
+		}(variant)
+	}
+
+	wg.Wait()
+}
+
+// runModule performs a single run of module with run, see runProbe
+func runModule(ctx context.Context, module *moduleConfig, cloud *cloudConfig, registry *prometheus.Registry, run func(ctx context.Context, r *probeRun) error) {
+	ctx, cancel := context.WithTimeout(ctx, module.Timeout)
+	defer cancel()
+
+	p := registeredProbes[module.Prober].probe
+	description := p.Description()
+
+	labels := prometheus.Labels{}
+
+	if cloud.name != "" {
+		labels["cloud"] = cloud.name
+	}
+
+	// The module label distinguishes modules sharing the same prober
+	if module.name != module.Prober {
+		labels["module"] = module.name
+	}
+
+	if module.AddressFamily != "" {
+		labels["address_family"] = module.AddressFamily
+	}
+
+	for i, value := range module.variant() {
+		if value != "" {
+			labels[variantLabels[i]] = value
+		}
+	}
+
+	success := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   program + "_" + p.Name(),
+		Name:        "success",
+		Help:        description.success,
+		ConstLabels: labels,
+	},
+		[]string{"reason", "step"},
+	)
+
+	timing := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   program + "_" + p.Name(),
+		Name:        "timing",
+		Help:        description.timing,
+		ConstLabels: labels,
+	},
+		[]string{
+			"step",
+		},
+	)
+
+	duration := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   program + "_" + p.Name(),
+		Name:        "step_duration_seconds",
+		Help:        "Duration of each step since the previous step",
+		ConstLabels: labels,
+	},
+		[]string{
+			"step",
+		},
+	)
+
+	elapsed := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   program + "_" + p.Name(),
+		Name:        "step_elapsed_seconds",
+		Help:        "Duration of each step since the start of the run",
+		ConstLabels: labels,
+	},
+		[]string{
+			"step",
+		},
+	)
+
+	registry.MustRegister(success)
+	registry.MustRegister(timing)
+	registry.MustRegister(duration)
+	registry.MustRegister(elapsed)
+
+	start := time.Now()
+
+	r := &probeRun{
+		cloud:    cloud,
+		module:   module,
+		registry: registry,
+		labels:   labels,
+		timing:   timing,
+		duration: duration,
+		elapsed:  elapsed,
+		start:    start,
+		last:     start,
+	}
+
+	c1 := make(chan error, 1)
+	go func() {
+		c1 <- run(ctx, r)
+	}()
+
+	var err error
+
+	select {
+	case err = <-c1:
+	case <-ctx.Done():
+		err = withReason(reasonTimeout, fmt.Errorf("request timeout reached"))
+	}
+
+	if err == nil {
+		success.WithLabelValues("", "").Set(1)
+		stats.record(cloud.name, module.name, module.variant(), "", "")
+		return
+	}
+
+	reason := classifyError(ctx, err)
+	lastStep := r.getLastStep()
+
+	stats.record(cloud.name, module.name, module.variant(), reason, lastStep)
+
+	log.Printf("ERROR: %s probe on cloud %q failed after step %s (%s): %s\n", module.logName(), cloud.name, lastStep, reason, err)
+	success.WithLabelValues(reason, lastStep).Set(0)
+
+	recordError(lastError{
+		time:   time.Now(),
+		cloud:  cloud.name,
+		probe:  module.logName(),
+		step:   lastStep,
+		reason: reason,
+		err:    err,
+	})
+}
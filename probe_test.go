@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stepDurationCount returns the number of durations observed for the step of
+// the probe run against cloud
+func stepDurationCount(t *testing.T, cloud string, probe string, step string) uint64 {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(stepDurations)
+
+	families, err := registry.Gather()
+
+	if err != nil {
+		t.Fatalf("cannot gather metrics: %s", err)
+	}
+
+	for _, family := range families {
+	metrics:
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+
+			for name, value := range map[string]string{"cloud": cloud, "probe": probe, "step": step} {
+				if labels[name] != value {
+					continue metrics
+				}
+			}
+
+			return metric.GetHistogram().GetSampleCount()
+		}
+	}
+
+	return 0
+}
+
+func TestStepDurations(t *testing.T) {
+	f := newFakeCloud(t)
+
+	// The histogram is shared by every test, the cloud name keeps its
+	// series apart
+	cloud := f.cloud()
+	cloud.name = "step-durations"
+
+	var result probeResult
+
+	for i := 0; i < 2; i++ {
+		if result = runTestProbe(t, testModule("object_store"), cloud); !result.success {
+			t.Fatalf("run %d: got %+v, want success", i, result)
+		}
+	}
+
+	for _, step := range []string{"start", "object_uploaded", "end"} {
+		if count := stepDurationCount(t, cloud.name, "object_store", step); count != 2 {
+			t.Errorf("got %d durations for step %s, want 2", count, step)
+		}
+	}
+
+	// The time elapsed at a step is the sum of the durations of the steps
+	// up to it
+	elapsed, ok := result.value(t, "openstack_client_object_store_step_elapsed_seconds", map[string]string{"step": "object_uploaded"})
+
+	if !ok || elapsed <= 0 {
+		t.Fatalf("got elapsed %v (%v) for step object_uploaded", elapsed, ok)
+	}
+
+	sum := 0.0
+
+	for _, step := range []string{"start", "auth_ok", "container_created", "object_uploaded"} {
+		duration, ok := result.value(t, "openstack_client_object_store_step_duration_seconds", map[string]string{"step": step})
+
+		if !ok {
+			t.Fatalf("no duration for step %s", step)
+		}
+
+		sum += duration
+	}
+
+	if math.Abs(elapsed-sum) > 1e-6 {
+		t.Errorf("got elapsed %v for step object_uploaded, want the sum of the durations %v", elapsed, sum)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scheduledProbe runs a probe in the background on its own interval and keeps
+// the metrics of its last completed run so that scrapes never wait on OpenStack.
+// A zero interval disables the background loop, the probe is then run when
+// scraped instead.
+type scheduledProbe struct {
+	name     string
+	interval time.Duration
+	module   *moduleConfig
+	cloud    *cloudConfig
+
+	mutex    sync.Mutex
+	registry *prometheus.Registry
+	finished time.Time
+	// running is closed when the in-flight run completes, nil when idle
+	running chan struct{}
+}
+
+func newScheduledProbe(module *moduleConfig, cloud *cloudConfig, interval time.Duration) *scheduledProbe {
+	return &scheduledProbe{
+		name:     module.name,
+		interval: interval,
+		module:   module,
+		cloud:    cloud,
+	}
+}
+
+// trigger starts a run unless one is already in flight, so that a probe never
+// creates OpenStack resources twice concurrently. It returns a channel closed
+// once the run completes and whether the caller joined an existing run.
+func (p *scheduledProbe) trigger() (done <-chan struct{}, joined bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.running != nil {
+		return p.running, true
+	}
+
+	running := make(chan struct{})
+	p.running = running
+
+	go func() {
+		p.runOnce()
+		close(running)
+	}()
+
+	return running, false
+}
+
+func (p *scheduledProbe) runOnce() {
+	registry := prometheus.NewRegistry()
+
+	// Each run of the probe is bounded by the timeout of the module
+	start := time.Now()
+	runProbe(context.Background(), p.module, p.cloud, registry)
+	log.Printf("%s probe on cloud %q finished in %v", p.name, p.cloud.name, time.Since(start))
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.registry = registry
+	p.finished = time.Now()
+	p.running = nil
+}
+
+func (p *scheduledProbe) loop() {
+	for {
+		start := time.Now()
+		done, _ := p.trigger()
+		<-done
+
+		sleepTime := p.interval - time.Since(start)
+		time.Sleep(sleepTime)
+	}
+}
+
+// lastResult returns the registry filled by the last completed run and the
+// time at which it completed, or a nil registry if no run completed yet
+func (p *scheduledProbe) lastResult() (*prometheus.Registry, time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.registry, p.finished
+}
+
+// scheduler holds every background probe and exposes their cached results
+type scheduler struct {
+	probes []*scheduledProbe
+
+	// targets holds the probes run on behalf of /probe, indexed by cloud and
+	// module name, so that concurrent requests for a target share their runs
+	targetsMutex sync.Mutex
+	targets      map[string]*scheduledProbe
+
+	ageDesc   *prometheus.Desc
+	coalesced *prometheus.CounterVec
+	rejected  *prometheus.CounterVec
+}
+
+func newScheduler(probes ...*scheduledProbe) *scheduler {
+	return &scheduler{
+		probes:  probes,
+		targets: map[string]*scheduledProbe{},
+		ageDesc: prometheus.NewDesc(
+			program+"_probe_result_age_seconds",
+			"Seconds elapsed since the cached result of each probe was produced",
+			[]string{"cloud", "probe"},
+			nil,
+		),
+		coalesced: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: program,
+			Name:      "scrapes_coalesced_total",
+			Help:      "Number of scrapes that joined an already running probe instead of starting a new run",
+		},
+			[]string{"cloud", "probe"},
+		),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: program,
+			Name:      "scrapes_rejected_total",
+			Help:      "Number of scrapes that gave up waiting for a running probe and got its previous result",
+		},
+			[]string{"cloud", "probe"},
+		),
+	}
+}
+
+func (s *scheduler) start() {
+	for _, p := range s.probes {
+		if p.interval > 0 {
+			go p.loop()
+		}
+	}
+}
+
+// refresh runs every probe without a background interval, concurrent calls
+// share the runs already in flight. It returns once all runs completed or when
+// ctx is done, in which case the previous results are served.
+func (s *scheduler) refresh(ctx context.Context) {
+	wg := sync.WaitGroup{}
+
+	for _, p := range s.probes {
+		if p.interval > 0 {
+			continue
+		}
+
+		done, joined := p.trigger()
+
+		if joined {
+			s.coalesced.WithLabelValues(p.cloud.name, p.name).Inc()
+		}
+
+		wg.Add(1)
+		go func(p *scheduledProbe) {
+			defer wg.Done()
+			s.wait(ctx, p, done)
+		}(p)
+	}
+
+	wg.Wait()
+}
+
+// wait blocks until done is closed or ctx is done, in which case the scrape
+// is counted as rejected
+func (s *scheduler) wait(ctx context.Context, p *scheduledProbe, done <-chan struct{}) {
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.rejected.WithLabelValues(p.cloud.name, p.name).Inc()
+	}
+}
+
+// probeTarget runs module against cloud, sharing the run with concurrent calls
+// for the same target. It returns the registry of the last completed run,
+// which is nil if ctx is done before any run completed.
+func (s *scheduler) probeTarget(ctx context.Context, cloud *cloudConfig, module *moduleConfig) *prometheus.Registry {
+	key := cloud.name + "/" + module.name
+
+	s.targetsMutex.Lock()
+	p, ok := s.targets[key]
+
+	if !ok {
+		p = newScheduledProbe(module, cloud, 0)
+		s.targets[key] = p
+	}
+	s.targetsMutex.Unlock()
+
+	done, joined := p.trigger()
+
+	if joined {
+		s.coalesced.WithLabelValues(cloud.name, p.name).Inc()
+	}
+
+	s.wait(ctx, p, done)
+
+	registry, _ := p.lastResult()
+
+	return registry
+}
+
+// gatherers returns the registries of the last completed run of every probe
+func (s *scheduler) gatherers() prometheus.Gatherers {
+	var gatherers prometheus.Gatherers
+
+	for _, p := range s.probes {
+		if registry, _ := p.lastResult(); registry != nil {
+			gatherers = append(gatherers, registry)
+		}
+	}
+
+	return gatherers
+}
+
+// Describe implements prometheus.Collector
+func (s *scheduler) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.ageDesc
+	s.coalesced.Describe(ch)
+	s.rejected.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (s *scheduler) Collect(ch chan<- prometheus.Metric) {
+	s.coalesced.Collect(ch)
+	s.rejected.Collect(ch)
+
+	for _, p := range s.probes {
+		registry, finished := p.lastResult()
+
+		if registry == nil {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(s.ageDesc, prometheus.GaugeValue, time.Since(finished).Seconds(), p.cloud.name, p.name)
+	}
+}
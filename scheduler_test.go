@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// blockingProbe is a probe whose runs block until released, to observe how
+// the scheduler shares runs between scrapes
+type blockingProbe struct {
+	mutex   sync.Mutex
+	runs    int
+	started chan struct{}
+	release chan struct{}
+}
+
+var testProbe = &blockingProbe{}
+
+// countingProbe counts its runs, which succeed at once until stopped and then
+// block until their context is done
+type countingProbe struct {
+	mutex   sync.Mutex
+	runs    int
+	stopped bool
+}
+
+var backgroundProbe = &countingProbe{}
+
+func init() {
+	registerProbe(testProbe, 0, false)
+	registerProbe(backgroundProbe, 0, false)
+}
+
+// reset forgets the previous runs, the next ones block until release is called
+func (p *blockingProbe) reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.runs = 0
+	p.started = make(chan struct{}, 10)
+	p.release = make(chan struct{})
+}
+
+func (p *blockingProbe) runCount() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.runs
+}
+
+func (p *blockingProbe) Name() string {
+	return "blocking"
+}
+
+func (p *blockingProbe) Description() probeDescription {
+	return probeDescription{success: "'1' when released", timing: "Timestamp of each step"}
+}
+
+func (p *blockingProbe) Run(ctx context.Context, r *probeRun) error {
+	p.mutex.Lock()
+	p.runs++
+	started, release := p.started, p.release
+	p.mutex.Unlock()
+
+	started <- struct{}{}
+
+	select {
+	case <-release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reset forgets the previous runs, the next ones succeed until stop is called
+func (p *countingProbe) reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.runs = 0
+	p.stopped = false
+}
+
+func (p *countingProbe) runCount() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.runs
+}
+
+func (p *countingProbe) stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.stopped = true
+}
+
+func (p *countingProbe) Name() string {
+	return "counting"
+}
+
+func (p *countingProbe) Description() probeDescription {
+	return probeDescription{success: "'1' until stopped", timing: "Timestamp of each step"}
+}
+
+func (p *countingProbe) Run(ctx context.Context, r *probeRun) error {
+	p.mutex.Lock()
+	p.runs++
+	stopped := p.stopped
+	p.mutex.Unlock()
+
+	if stopped {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+func TestTriggerSharesRun(t *testing.T) {
+	testProbe.reset()
+	p := newScheduledProbe(testModule("blocking"), &cloudConfig{name: "test"}, 0)
+
+	first, joined := p.trigger()
+
+	if joined {
+		t.Fatal("first trigger joined a run")
+	}
+
+	<-testProbe.started
+
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if done, joined := p.trigger(); !joined || done != first {
+				t.Error("concurrent trigger did not join the run in flight")
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(testProbe.release)
+	<-first
+
+	if runs := testProbe.runCount(); runs != 1 {
+		t.Errorf("got %d runs, want 1", runs)
+	}
+
+	if registry, finished := p.lastResult(); registry == nil || finished.IsZero() {
+		t.Error("no result after the run completed")
+	}
+
+	// Once the run completed, a trigger starts a new one
+	testProbe.reset()
+	close(testProbe.release)
+
+	if done, joined := p.trigger(); joined {
+		t.Error("trigger after completion joined the previous run")
+	} else {
+		<-done
+	}
+}
+
+func TestSchedulerRefresh(t *testing.T) {
+	testProbe.reset()
+
+	cloud := &cloudConfig{name: "test"}
+	onScrape := newScheduledProbe(testModule("blocking"), cloud, 0)
+	background := newScheduledProbe(testModule("blocking"), cloud, time.Hour)
+	background.name = "background"
+	s := newScheduler(onScrape, background)
+
+	// A first scrape starts the run of the interval-0 probe and waits for it
+	refreshed := make(chan struct{})
+
+	go func() {
+		s.refresh(context.Background())
+		close(refreshed)
+	}()
+
+	<-testProbe.started
+
+	// A concurrent scrape joins the run and gives up when its context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.refresh(ctx)
+
+	close(testProbe.release)
+	<-refreshed
+
+	if runs := testProbe.runCount(); runs != 1 {
+		t.Errorf("got %d runs, want 1 for the interval-0 probe only", runs)
+	}
+
+	if registry, _ := onScrape.lastResult(); registry == nil {
+		t.Error("no result for the interval-0 probe after a scrape")
+	}
+
+	if registry, _ := background.lastResult(); registry != nil {
+		t.Error("the background probe was run on scrape")
+	}
+
+	if value := testutil.ToFloat64(s.coalesced.WithLabelValues("test", "blocking")); value != 1 {
+		t.Errorf("got %v coalesced scrapes, want 1", value)
+	}
+
+	if value := testutil.ToFloat64(s.rejected.WithLabelValues("test", "blocking")); value != 1 {
+		t.Errorf("got %v rejected scrapes, want 1", value)
+	}
+}
+
+func TestSchedulerBackgroundRuns(t *testing.T) {
+	backgroundProbe.reset()
+	module := testModule("counting")
+	// Once stopped, the runs of the background loop, which never ends, last
+	// until the end of the tests
+	module.Timeout = time.Hour
+	t.Cleanup(backgroundProbe.stop)
+
+	p := newScheduledProbe(module, &cloudConfig{name: "test"}, 10*time.Millisecond)
+	s := newScheduler(p)
+	s.start()
+
+	// The probe runs on its interval without any scrape
+	deadline := time.Now().Add(5 * time.Second)
+
+	for backgroundProbe.runCount() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d runs without scrape, want at least 3", backgroundProbe.runCount())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(s)
+
+	families, err := registry.Gather()
+
+	if err != nil {
+		t.Fatalf("cannot gather metrics: %s", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != "openstack_client_probe_result_age_seconds" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			if age := metric.GetGauge().GetValue(); age < 0 || age > 1 {
+				t.Errorf("got a result age of %vs, want less than the interval", age)
+			}
+
+			return
+		}
+	}
+
+	t.Error("no result age exported")
+}
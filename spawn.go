@@ -9,6 +9,7 @@ import (
 	"log"
 	"net"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +20,7 @@ import (
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/keypairs"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/schedulerhints"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
@@ -27,32 +29,63 @@ import (
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
-	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/crypto/ssh"
 )
 
 const (
-	volumeSize = 10
+	defaultVolumeSize = 10
+	defaultSSHPort    = 22
 )
 
+// Boot modes of the spawn probe
+const (
+	// bootModeVolume boots from a volume created from the image by the probe
+	bootModeVolume = "volume"
+	// bootModeImage boots from the image on the ephemeral disk of the hypervisor
+	bootModeImage = "image"
+	// bootModeImageVolume boots from a volume created from the image by Nova
+	bootModeImageVolume = "image_volume"
+)
+
+var bootModes = []string{bootModeVolume, bootModeImage, bootModeImageVolume}
+
+// Address families the spawn probe reaches the instance with, over a floating
+// IPv4 address or directly over its global IPv6 address
+const (
+	addressFamilyIPv4 = "ipv4"
+	addressFamilyIPv6 = "ipv6"
+)
+
+var addressFamilies = []string{addressFamilyIPv4, addressFamilyIPv6}
+
+var errHostKeyMismatch = fmt.Errorf("ssh: host key mismatch")
+
+// sshDialer connects to the SSH servers of the instances, the tests reach
+// their fake SSH servers through it
+var sshDialer = ssh.Dial
+
+// getImage returns the image with the given name, or with the given ID so
+// that a given image may be picked among several ones with the same name
 func getImage(client *gophercloud.ServiceClient, name string) (*images.Image, error) {
-	page, err := images.List(client, images.ListOpts{Name: name}).AllPages()
+	for _, opts := range []images.ListOpts{{Name: name}, {ID: name}} {
+		page, err := images.List(client, opts).AllPages()
 
-	if err != nil {
-		return nil, err
-	}
+		if err != nil {
+			return nil, fmt.Errorf("cannot list images: %w", err)
+		}
 
-	AllImages, err := images.ExtractImages(page)
+		AllImages, err := images.ExtractImages(page)
 
-	if err != nil {
-		return nil, err
-	}
+		if err != nil {
+			return nil, err
+		}
 
-	if len(AllImages) > 0 {
-		return &AllImages[0], nil
+		if len(AllImages) > 0 {
+			return &AllImages[0], nil
+		}
 	}
 
-	return nil, fmt.Errorf("image not found")
+	return nil, withReason(reasonNotFound, fmt.Errorf("image %s not found", name))
 }
 
 func getFlavor(client *gophercloud.ServiceClient, name string) (*flavors.Flavor, error) {
@@ -90,10 +123,10 @@ func getNetwork(client *gophercloud.ServiceClient, name string) (*networks.Netwo
 		}
 	}
 
-	return nil, fmt.Errorf("network not found")
+	return nil, withReason(reasonNotFound, fmt.Errorf("network not found"))
 }
 
-func getHostKey(ctx context.Context, client *gophercloud.ServiceClient, server servers.Server, timing prometheus.GaugeVec) (hostKeys []ssh.PublicKey, err error) {
+func getHostKey(ctx context.Context, client *gophercloud.ServiceClient, server servers.Server, r *probeRun) (hostKeys []ssh.PublicKey, err error) {
 	bootStarted := false
 	for {
 		consoleOutput, err := servers.ShowConsoleOutput(client, server.ID, servers.ShowConsoleOutputOpts{}).Extract()
@@ -101,7 +134,7 @@ func getHostKey(ctx context.Context, client *gophercloud.ServiceClient, server s
 		if err == nil {
 			if consoleOutput != "" && !bootStarted {
 				bootStarted = true
-				if err := step(ctx, timing, "boot_started"); err != nil {
+				if err := r.step(ctx, "boot_started"); err != nil {
 					return nil, err
 				}
 			}
@@ -135,7 +168,7 @@ func getPort(networkClient *gophercloud.ServiceClient, serverID string) (*ports.
 	page, err := ports.List(networkClient, ports.ListOpts{DeviceID: serverID}).AllPages()
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to get instance port ID")
+		return nil, fmt.Errorf("failed to get instance port ID: %w", err)
 	}
 
 	allPorts, err := ports.ExtractPorts(page)
@@ -165,14 +198,16 @@ func generateSSHKey() (*rsa.PrivateKey, string, error) {
 	return privateKey, publicKeyString, nil
 }
 
-func sshServer(ctx context.Context, ip string, hostKeys []ssh.PublicKey, privateKey rsa.PrivateKey) error {
+// sshClientConfig returns the settings to connect as user with privateKey to
+// a server whose host key is one of hostKeys
+func sshClientConfig(user string, hostKeys []ssh.PublicKey, privateKey rsa.PrivateKey) (*ssh.ClientConfig, error) {
 	signer, err := ssh.NewSignerFromKey(&privateKey)
 	if err != nil {
-		return fmt.Errorf("unable to create signer from private key: %s", err)
+		return nil, fmt.Errorf("unable to create signer from private key: %w", err)
 	}
 
 	config := &ssh.ClientConfig{
-		User: userName,
+		User: user,
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(signer),
 		},
@@ -184,129 +219,306 @@ func sshServer(ctx context.Context, ip string, hostKeys []ssh.PublicKey, private
 				}
 			}
 
-			return fmt.Errorf("ssh: host key mismatch")
+			return errHostKeyMismatch
 		},
 	}
 
+	return config, nil
+}
+
+// sshServer connects to address over SSH until the whoami command succeeds,
+// the host key of the server must be one of hostKeys
+func sshServer(ctx context.Context, address string, user string, hostKeys []ssh.PublicKey, privateKey rsa.PrivateKey) error {
+	config, err := sshClientConfig(user, hostKeys, privateKey)
+	if err != nil {
+		return err
+	}
+
+	// The last error is kept to tell why the connection failed on timeout
+	var lastErr error
+
 	for {
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("timeout during ssh connection")
+			if lastErr != nil {
+				return withReason(sshReason(lastErr), fmt.Errorf("timeout during ssh connection: %w", lastErr))
+			}
+			return withReason(reasonTimeout, fmt.Errorf("timeout during ssh connection"))
 		default:
 		}
 
-		client, err := ssh.Dial("tcp", ip+":22", config)
-		if err != nil {
-			log.Printf("Failed to dial: %s", err)
+		if err := sshRun(address, config, "/usr/bin/whoami"); err != nil {
+			log.Printf("SSH connection failed: %s", err)
+			lastErr = err
 			time.Sleep(1 * time.Second)
 			continue
 		}
-		defer client.Close()
 
-		session, err := client.NewSession()
+		log.Printf("SSH connection was successful")
+
+		return nil
+	}
+}
+
+// sshRun runs command on the SSH server at address
+func sshRun(address string, config *ssh.ClientConfig, command string) error {
+	client, err := sshDialer("tcp", address, config)
+	if err != nil {
+		return fmt.Errorf("failed to dial: %w", err)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	defer session.Close()
+
+	var b bytes.Buffer
+	session.Stdout = &b
+	if err := session.Run(command); err != nil {
+		return fmt.Errorf("failed to run: %w", err)
+	}
+
+	return nil
+}
+
+// createFloatingIPs finds the external network and creates count floating IPs
+// on it
+func createFloatingIPs(ctx context.Context, r *probeRun, networkClient *gophercloud.ServiceClient, name string, count int) ([]*floatingips.FloatingIP, error) {
+	externalNetwork, err := getNetwork(networkClient, r.module.ExternalNetwork)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to find external network: %w", err)
+	}
+
+	if err := r.step(ctx, "external_network_id"); err != nil {
+		return nil, err
+	}
+
+	log.Printf("External network found %s\n", externalNetwork.ID)
+
+	var fips []*floatingips.FloatingIP
+
+	for i := 0; i < count; i++ {
+		fip, err := floatingips.Create(networkClient, floatingips.CreateOpts{
+			FloatingNetworkID: externalNetwork.ID,
+			Description:       name,
+		}).Extract()
+
 		if err != nil {
-			log.Printf("Failed to create session: %s", err)
-			time.Sleep(1 * time.Second)
-			continue
+			return nil, fmt.Errorf("floating IP failure: %w", err)
 		}
-		defer session.Close()
 
-		var b bytes.Buffer
-		session.Stdout = &b
-		if err := session.Run("/usr/bin/whoami"); err != nil {
-			log.Printf("Failed to run: " + err.Error())
-			time.Sleep(1 * time.Second)
-			continue
-		}
+		log.Printf("Floating IP: %s", fip.FloatingIP)
 
-		log.Printf("SSH connection was successful")
+		fips = append(fips, fip)
+	}
 
-		break
+	return fips, nil
+}
+
+// globalIPv6Address returns the first global IPv6 address of port
+func globalIPv6Address(port *ports.Port) (string, error) {
+	for _, fixedIP := range port.FixedIPs {
+		ip := net.ParseIP(fixedIP.IPAddress)
+
+		if ip != nil && ip.To4() == nil && ip.IsGlobalUnicast() {
+			return ip.String(), nil
+		}
 	}
 
-	return nil
+	return "", withReason(reasonNotFound, fmt.Errorf("port %s has no global IPv6 address", port.ID))
 }
 
-func spawnInstance(ctx context.Context, timing prometheus.GaugeVec) error {
-	if err := step(ctx, timing, "start"); err != nil {
-		return err
+// waitServer waits until the server reaches the ACTIVE status
+func waitServer(ctx context.Context, client *gophercloud.ServiceClient, id string) (*servers.Server, error) {
+	return waitServerStatus(ctx, client, id, "ACTIVE")
+}
+
+// waitServerStatus waits until the server reaches status
+func waitServerStatus(ctx context.Context, client *gophercloud.ServiceClient, id string, status string) (*servers.Server, error) {
+	for {
+		server, err := servers.Get(client, id).Extract()
+
+		if err == nil && server.Status == status {
+			return server, nil
+		}
+
+		if err == nil && server.Status == "ERROR" {
+			return nil, withReason(reasonResourceError, fmt.Errorf("server %s reached ERROR status", id))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timeout waiting for server to reach %s status", status)
+		default:
+		}
+
+		time.Sleep(1 * time.Second)
 	}
+}
 
-	resourceName := createName()
-	log.Printf("spawnInstance using resource name %s\n", resourceName)
+// createVolume creates a volume of the size of the module from the image,
+// snapshot or volume set in source, or an empty one when source is empty, and
+// waits until it is available. The names of its steps start with stepPrefix.
+func createVolume(ctx context.Context, r *probeRun, provider *gophercloud.ProviderClient, name string, source volumes.CreateOpts, stepPrefix string) (*volumes.Volume, error) {
+	volumeClient, err := openstack.NewBlockStorageV2(provider, r.cloud.endpointOpts())
 
-	provider, err := getProvider(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cinder client failure: %w", err)
+	}
+
+	source.Size = r.module.VolumeSize
+	source.Name = name
+	source.AvailabilityZone = r.module.VolumeAvailabilityZone
+
+	if source.AvailabilityZone == "" {
+		source.AvailabilityZone = r.module.availabilityZone
+	}
+
+	volume, err := volumes.Create(volumeClient, source).Extract()
 
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("volume creation failed: %w", err)
 	}
 
-	if err := step(ctx, timing, "auth_ok"); err != nil {
-		return err
+	if err := r.step(ctx, stepPrefix+"volume_created"); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Volume created %s\n", volume.ID)
+
+	volume, err = waitVolume(ctx, volumeClient, volume.ID, "available")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.step(ctx, stepPrefix+"volume_available"); err != nil {
+		return nil, err
 	}
 
+	log.Printf("Volume %s is available", volume.ID)
+
+	return volume, nil
+}
+
+// waitVolume waits until the volume reaches status
+func waitVolume(ctx context.Context, client *gophercloud.ServiceClient, id string, status string) (*volumes.Volume, error) {
+	for {
+		volume, err := volumes.Get(client, id).Extract()
+
+		if err == nil && volume.Status == status {
+			return volume, nil
+		}
+
+		if err == nil && strings.HasPrefix(volume.Status, "error") {
+			return nil, withReason(reasonResourceError, fmt.Errorf("volume %s reached %s status", id, volume.Status))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timeout waiting for volume to reach %s status", status)
+		default:
+		}
+
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// bootResources are the image, flavor and internal network servers are booted
+// with, along with the clients booting them
+type bootResources struct {
+	computeClient *gophercloud.ServiceClient
+	networkClient *gophercloud.ServiceClient
+	image         *images.Image
+	flavor        *flavors.Flavor
+	network       *networks.Network
+}
+
+// findBootResources finds the image, flavor and internal network of the module
+// by name
+func findBootResources(ctx context.Context, r *probeRun, provider *gophercloud.ProviderClient) (*bootResources, error) {
+	res := &bootResources{}
+
 	// Find image ID by name
 
-	imageClient, err := openstack.NewImageServiceV2(provider, gophercloud.EndpointOpts{})
+	imageClient, err := openstack.NewImageServiceV2(provider, r.cloud.endpointOpts())
 
 	if err != nil {
-		return fmt.Errorf("glance client failure: %s", err)
+		return nil, fmt.Errorf("glance client failure: %w", err)
 	}
 
-	image, err := getImage(imageClient, imageName)
+	res.image, err = getImage(imageClient, r.module.Image)
 
 	if err != nil {
-		return fmt.Errorf("image not found: %s", err)
+		return nil, err
 	}
 
-	log.Printf("Image found %s\n", image.ID)
+	log.Printf("Image found %s\n", res.image.ID)
 
-	if err := step(ctx, timing, "image_id"); err != nil {
-		return err
+	if err := r.step(ctx, "image_id"); err != nil {
+		return nil, err
 	}
 
 	// Find flavor by name
 
-	computeClient, err := openstack.NewComputeV2(provider, gophercloud.EndpointOpts{})
+	res.computeClient, err = openstack.NewComputeV2(provider, r.cloud.endpointOpts())
 
 	if err != nil {
-		return fmt.Errorf("nova client failure: %f", err)
+		return nil, fmt.Errorf("nova client failure: %w", err)
 	}
 
-	flavor, err := getFlavor(computeClient, flavorName)
+	res.flavor, err = getFlavor(res.computeClient, r.module.Flavor)
 
 	if err != nil {
-		return fmt.Errorf("flavor not found: %f", err)
+		return nil, fmt.Errorf("flavor not found: %w", err)
 	}
 
-	if err := step(ctx, timing, "flavor_id"); err != nil {
-		return err
+	if err := r.step(ctx, "flavor_id"); err != nil {
+		return nil, err
 	}
 
 	// Find internal network by name
 
-	networkClient, err := openstack.NewNetworkV2(provider, gophercloud.EndpointOpts{})
+	res.networkClient, err = openstack.NewNetworkV2(provider, r.cloud.endpointOpts())
 
 	if err != nil {
-		return fmt.Errorf("neutron client failure: %s", err)
+		return nil, fmt.Errorf("neutron client failure: %w", err)
 	}
 
-	network, err := getNetwork(networkClient, internalNetwork)
+	res.network, err = getNetwork(res.networkClient, r.module.InternalNetwork)
 
 	if err != nil {
-		return fmt.Errorf("cannot get network: %s", err)
+		return nil, fmt.Errorf("cannot get network: %w", err)
 	}
 
-	if err := step(ctx, timing, "network_id"); err != nil {
-		return err
+	if err := r.step(ctx, "network_id"); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// etherType returns the ether type of the address family the servers of the
+// module are reached with
+func (m *moduleConfig) etherType() rules.RuleEtherType {
+	if m.AddressFamily == addressFamilyIPv6 {
+		return rules.EtherType6
 	}
 
-	// Create security group
+	return rules.EtherType4
+}
 
-	securityGroup, err := groups.Create(networkClient, groups.CreateOpts{Name: resourceName}).Extract()
+// createSecurityGroup creates a security group allowing SSH from anywhere over
+// the address family of the module, along with the rules returned by
+// extraRules for its ID
+func createSecurityGroup(ctx context.Context, r *probeRun, networkClient *gophercloud.ServiceClient, name string, extraRules func(securityGroupID string) []rules.CreateOpts) (*groups.SecGroup, error) {
+	securityGroup, err := groups.Create(networkClient, groups.CreateOpts{Name: name}).Extract()
 
 	if err != nil {
-		return fmt.Errorf("security group failure: %s", err)
+		return nil, fmt.Errorf("security group failure: %w", err)
 	}
 
 	// Neutron tags are not supported on our Mitaka...
@@ -317,203 +529,307 @@ func spawnInstance(ctx context.Context, timing prometheus.GaugeVec) error {
 	// 	return fmt.Errorf("security group tagging failed: %s", err)
 	// }
 
-	if err := step(ctx, timing, "security_group_created"); err != nil {
-		return err
+	if err := r.step(ctx, "security_group_created"); err != nil {
+		return nil, err
 	}
 
 	log.Printf("Security group %s created", securityGroup.ID)
 
-	// Add SSH rule to security group
+	ruleOpts := []rules.CreateOpts{
+		{
+			Direction:    "ingress",
+			PortRangeMin: r.module.SSHPort,
+			EtherType:    r.module.etherType(),
+			PortRangeMax: r.module.SSHPort,
+			Protocol:     "tcp",
+			SecGroupID:   securityGroup.ID,
+		},
+	}
 
-	createOpts := rules.CreateOpts{
-		Direction:    "ingress",
-		PortRangeMin: 22,
-		EtherType:    rules.EtherType4,
-		PortRangeMax: 22,
-		Protocol:     "tcp",
-		SecGroupID:   securityGroup.ID,
+	if extraRules != nil {
+		ruleOpts = append(ruleOpts, extraRules(securityGroup.ID)...)
 	}
 
-	rule, err := rules.Create(networkClient, createOpts).Extract()
+	for _, opts := range ruleOpts {
+		rule, err := rules.Create(networkClient, opts).Extract()
 
-	if err != nil {
-		return fmt.Errorf("security group rule failure: %s", err)
-	}
+		if err != nil {
+			return nil, fmt.Errorf("security group rule failure: %w", err)
+		}
 
-	if err := step(ctx, timing, "security_group_rule_created"); err != nil {
-		return err
+		log.Printf("Security group rule %s\n", rule.ID)
 	}
 
-	log.Printf("Security group rule %s\n", rule.ID)
-
-	// Generate and upload SSH key
+	return securityGroup, nil
+}
 
+// uploadSSHKey generates an SSH key and uploads it as the keypair name
+func uploadSSHKey(ctx context.Context, r *probeRun, computeClient *gophercloud.ServiceClient, name string) (*keypairs.KeyPair, *rsa.PrivateKey, error) {
 	privateKey, publicKey, err := generateSSHKey()
 
 	if err != nil {
-		return fmt.Errorf("SSH key creation failure: %s", err)
+		return nil, nil, fmt.Errorf("SSH key creation failure: %w", err)
 	}
 
-	keypair, err := keypairs.Create(computeClient, keypairs.CreateOpts{Name: resourceName, PublicKey: publicKey}).Extract()
+	keypair, err := keypairs.Create(computeClient, keypairs.CreateOpts{Name: name, PublicKey: publicKey}).Extract()
 
 	if err != nil {
-		return fmt.Errorf("SSH key upload failure: %s", err)
+		return nil, nil, fmt.Errorf("SSH key upload failure: %w", err)
 	}
 
-	if err := step(ctx, timing, "ssh_key_uploaded"); err != nil {
-		return err
+	if err := r.step(ctx, "ssh_key_uploaded"); err != nil {
+		return nil, nil, err
 	}
 
-	// Find external network by name
+	return keypair, privateKey, nil
+}
 
-	externalNetwork, err := getNetwork(networkClient, externalNetwork)
+// bootServer boots a server with opts and keyName in the boot mode of the
+// module, in the server group serverGroupID when set. In volume mode, the boot
+// volume is created first, the names of its steps starting with stepPrefix.
+func bootServer(ctx context.Context, r *probeRun, provider *gophercloud.ProviderClient, res *bootResources, opts servers.CreateOpts, keyName string, serverGroupID string, stepPrefix string) (*servers.Server, error) {
+	// Create boot volume, unless the server boots from the image
 
-	if err != nil {
-		return fmt.Errorf("failed to find external network: %s", err)
+	var bootVolume *volumes.Volume
+
+	if r.module.BootMode == bootModeVolume {
+		var err error
+
+		bootVolume, err = createVolume(ctx, r, provider, opts.Name, volumes.CreateOpts{ImageID: res.image.ID}, stepPrefix)
+
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if err := step(ctx, timing, "external_network_id"); err != nil {
-		return err
+	if r.module.BootMode == bootModeImage {
+		opts.ImageRef = res.image.ID
 	}
 
-	log.Printf("External network found %s\n", externalNetwork.ID)
+	var bootOpts servers.CreateOptsBuilder = keypairs.CreateOptsExt{
+		CreateOptsBuilder: opts,
+		KeyName:           keyName,
+	}
 
-	// Create floating IP on the external network
+	if serverGroupID != "" {
+		bootOpts = schedulerhints.CreateOptsExt{
+			CreateOptsBuilder: bootOpts,
+			SchedulerHints:    schedulerhints.SchedulerHints{Group: serverGroupID},
+		}
+	}
 
-	fip, err := floatingips.Create(networkClient, floatingips.CreateOpts{
-		FloatingNetworkID: externalNetwork.ID,
-		Description:       resourceName,
-	}).Extract()
+	var server *servers.Server
+	var err error
+
+	switch r.module.BootMode {
+	case bootModeVolume:
+		server, err = bootfromvolume.Create(res.computeClient, bootfromvolume.CreateOptsExt{
+			CreateOptsBuilder: bootOpts,
+			BlockDevice: []bootfromvolume.BlockDevice{
+				bootfromvolume.BlockDevice{
+					BootIndex:       0,
+					UUID:            bootVolume.ID,
+					SourceType:      bootfromvolume.SourceVolume,
+					DestinationType: bootfromvolume.DestinationVolume,
+				},
+			},
+		}).Extract()
+	case bootModeImageVolume:
+		// Nova creates the volume from the image and deletes it along
+		// with the server
+		server, err = bootfromvolume.Create(res.computeClient, bootfromvolume.CreateOptsExt{
+			CreateOptsBuilder: bootOpts,
+			BlockDevice: []bootfromvolume.BlockDevice{
+				bootfromvolume.BlockDevice{
+					BootIndex:           0,
+					UUID:                res.image.ID,
+					SourceType:          bootfromvolume.SourceImage,
+					DestinationType:     bootfromvolume.DestinationVolume,
+					VolumeSize:          r.module.VolumeSize,
+					DeleteOnTermination: true,
+				},
+			},
+		}).Extract()
+	default:
+		server, err = servers.Create(res.computeClient, bootOpts).Extract()
+	}
 
 	if err != nil {
-		return fmt.Errorf("floating IP failure: %s", err)
+		return nil, fmt.Errorf("server creation failed: %w", err)
 	}
 
-	if err := step(ctx, timing, "floating_ip_created"); err != nil {
-		return err
+	log.Printf("Server created %s\n", server.ID)
+
+	return server, nil
+}
+
+// serverAddress returns the address the server is reached with over the
+// address family of the module, its global IPv6 address or fip once associated
+// with its port, along with the port
+func serverAddress(r *probeRun, networkClient *gophercloud.ServiceClient, serverID string, fip *floatingips.FloatingIP) (string, *ports.Port, error) {
+	port, err := getPort(networkClient, serverID)
+
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot get server port: %w", err)
 	}
 
-	log.Printf("Floating IP: %s", fip.FloatingIP)
+	if r.module.AddressFamily == addressFamilyIPv6 {
+		ip, err := globalIPv6Address(port)
 
-	// Create boot volume
+		if err != nil {
+			return "", nil, err
+		}
 
-	volumeClient, err := openstack.NewBlockStorageV2(provider, gophercloud.EndpointOpts{})
+		log.Printf("IPv6 address %s found on port %s", ip, port.ID)
 
-	if err != nil {
-		return fmt.Errorf("cinder client failure: %f", err)
+		return ip, port, nil
 	}
 
-	volume, err := volumes.Create(volumeClient, volumes.CreateOpts{
-		Size:    volumeSize,
-		Name:    resourceName,
-		ImageID: image.ID,
-	}).Extract()
+	_, err = floatingips.Update(networkClient, fip.ID, floatingips.UpdateOpts{PortID: &port.ID}).Extract()
 
 	if err != nil {
-		return fmt.Errorf("volume creation failed: %s", err)
+		return "", nil, fmt.Errorf("failed to assign floating IP: %w", err)
 	}
 
-	if err := step(ctx, timing, "volume_created"); err != nil {
-		return err
+	log.Printf("Floating IP %s has been successfuly associated with port %s", fip.FloatingIP, port.ID)
+
+	return fip.FloatingIP, port, nil
+}
+
+// addressStep returns the name of the step reached once the servers are
+// reachable, named after the address family of the module
+func (m *moduleConfig) addressStep() string {
+	if m.AddressFamily == addressFamilyIPv6 {
+		return "ipv6_address_found"
 	}
 
-	log.Printf("Volume created %s\n", volume.ID)
+	return "floating_ip_associated"
+}
 
-	for {
-		volume, err = volumes.Get(volumeClient, volume.ID).Extract()
+func spawnInstance(ctx context.Context, r *probeRun) error {
+	if err := r.step(ctx, "start"); err != nil {
+		return err
+	}
 
-		if err == nil && volume.Status == "available" {
-			break
-		}
+	provider, err := getProvider(ctx, r.cloud)
 
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("timeout waiting for volume to reach available status")
-		default:
-		}
+	if err != nil {
+		return err
+	}
 
-		time.Sleep(1 * time.Second)
+	if err := r.step(ctx, "auth_ok"); err != nil {
+		return err
 	}
 
-	if err := step(ctx, timing, "volume_available"); err != nil {
+	return spawnAuthenticated(ctx, r, provider)
+}
+
+// spawnAuthenticated runs the spawn flow from the lookup of the image, once
+// authenticated with provider
+func spawnAuthenticated(ctx context.Context, r *probeRun, provider *gophercloud.ProviderClient) error {
+	resourceName := createName()
+	log.Printf("spawnInstance using resource name %s\n", resourceName)
+
+	res, err := findBootResources(ctx, r, provider)
+
+	if err != nil {
 		return err
 	}
 
-	log.Printf("Volume %s is available", volume.ID)
+	computeClient := res.computeClient
 
-	// Boot server
+	// Create security group allowing SSH
 
-	server, err := bootfromvolume.Create(computeClient, bootfromvolume.CreateOptsExt{
-		keypairs.CreateOptsExt{
-			CreateOptsBuilder: servers.CreateOpts{
-				Name:           resourceName,
-				FlavorRef:      flavor.ID,
-				Networks:       []servers.Network{servers.Network{UUID: network.ID}},
-				SecurityGroups: []string{securityGroup.ID},
-			},
-			KeyName: keypair.Name,
-		},
-		[]bootfromvolume.BlockDevice{
-			bootfromvolume.BlockDevice{
-				BootIndex:       0,
-				UUID:            volume.ID,
-				SourceType:      bootfromvolume.SourceVolume,
-				DestinationType: bootfromvolume.DestinationVolume,
-			},
-		},
-	}).Extract()
+	securityGroup, err := createSecurityGroup(ctx, r, res.networkClient, resourceName, nil)
 
 	if err != nil {
-		return fmt.Errorf("server creation failed: %s", err)
+		return err
 	}
 
-	if err := step(ctx, timing, "server_created"); err != nil {
+	if err := r.step(ctx, "security_group_rule_created"); err != nil {
 		return err
 	}
 
-	log.Printf("Server created %s\n", server.ID)
+	// Generate and upload SSH key
 
-	for {
-		server, err = servers.Get(computeClient, server.ID).Extract()
+	keypair, privateKey, err := uploadSSHKey(ctx, r, computeClient, resourceName)
 
-		if err == nil && server.Status == "ACTIVE" {
-			break
+	if err != nil {
+		return err
+	}
+
+	// Create floating IP on the external network, unless the server is
+	// reached on its IPv6 address
+
+	var fip *floatingips.FloatingIP
+
+	if r.module.AddressFamily != addressFamilyIPv6 {
+		fips, err := createFloatingIPs(ctx, r, res.networkClient, resourceName, 1)
+
+		if err != nil {
+			return err
 		}
 
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("timeout waiting for server to reach ACTIVE status")
-		default:
+		if err := r.step(ctx, "floating_ip_created"); err != nil {
+			return err
 		}
 
-		time.Sleep(1 * time.Second)
+		fip = fips[0]
 	}
 
-	if err := step(ctx, timing, "server_active_status"); err != nil {
-		return err
+	// Boot server
+
+	serverOpts := servers.CreateOpts{
+		Name:             resourceName,
+		FlavorRef:        res.flavor.ID,
+		Networks:         []servers.Network{servers.Network{UUID: res.network.ID}},
+		SecurityGroups:   []string{securityGroup.ID},
+		AvailabilityZone: r.module.availabilityZone,
 	}
 
-	log.Println("Server is ACTIVE")
+	if r.module.ConfigDrive {
+		serverOpts.ConfigDrive = &r.module.ConfigDrive
+	}
 
-	// Assign floating IP
+	var nonce string
+
+	if r.module.UserData {
+		nonce, serverOpts.UserData = newUserData()
+	}
 
-	port, err := getPort(networkClient, server.ID)
+	server, err := bootServer(ctx, r, provider, res, serverOpts, keypair.Name, "", "")
 
 	if err != nil {
-		return fmt.Errorf("cannot get server port: %s", err)
+		return err
 	}
 
-	_, err = floatingips.Update(networkClient, fip.ID, floatingips.UpdateOpts{PortID: &port.ID}).Extract()
+	if err := r.step(ctx, "server_created"); err != nil {
+		return err
+	}
+
+	server, err = waitServer(ctx, computeClient, server.ID)
 
 	if err != nil {
-		return fmt.Errorf("failed to assign floating IP: %s", err)
+		return err
 	}
 
-	if err := step(ctx, timing, "floating_ip_associated"); err != nil {
+	if err := r.step(ctx, "server_active_status"); err != nil {
 		return err
 	}
 
-	log.Printf("Floating IP %s has been successfuly associated with port %s", fip.FloatingIP, port.ID)
+	log.Println("Server is ACTIVE")
+
+	// Find the address to SSH into the instance
+
+	ip, _, err := serverAddress(r, res.networkClient, server.ID, fip)
+
+	if err != nil {
+		return err
+	}
+
+	if err := r.step(ctx, r.module.addressStep()); err != nil {
+		return err
+	}
 
 	// Monitor serial console
 
@@ -537,13 +853,13 @@ func spawnInstance(ctx context.Context, timing prometheus.GaugeVec) error {
 
 	var hostKeys []ssh.PublicKey
 
-	hostKeys, err = getHostKey(ctx, computeClient, *server, timing)
+	hostKeys, err = getHostKey(ctx, computeClient, *server, r)
 
 	if err != nil {
 		log.Printf("host key: %s\n", err)
 	}
 
-	if err := step(ctx, timing, "ssh_host_keys_retrieved"); err != nil {
+	if err := r.step(ctx, "ssh_host_keys_retrieved"); err != nil {
 		return err
 	}
 
@@ -551,58 +867,94 @@ func spawnInstance(ctx context.Context, timing prometheus.GaugeVec) error {
 
 	// SSH into instance
 
-	if err := sshServer(ctx, fip.FloatingIP, hostKeys, *privateKey); err != nil {
-		return fmt.Errorf("SSH connection failed: %s", err)
+	address := net.JoinHostPort(ip, strconv.Itoa(r.module.SSHPort))
+
+	if err := sshServer(ctx, address, r.module.User, hostKeys, *privateKey); err != nil {
+		return fmt.Errorf("SSH connection failed: %w", err)
 	}
 
-	if err := step(ctx, timing, "ssh_successful"); err != nil {
+	if err := r.step(ctx, "ssh_successful"); err != nil {
 		return err
 	}
 
-	if err := step(ctx, timing, "end"); err != nil {
+	config, err := sshClientConfig(r.module.User, hostKeys, *privateKey)
+
+	if err != nil {
+		return err
+	}
+
+	// Check the user-data script ran
+
+	if r.module.UserData {
+		if err := checkUserData(ctx, r, computeClient, server.ID, address, config, nonce); err != nil {
+			return err
+		}
+	}
+
+	// Check the metadata seen by the instance
+
+	if r.module.Metadata || r.module.ConfigDrive {
+		if err := checkMetadata(ctx, r, address, config, server.ID, resourceName, keypair.Name, keypair.PublicKey); err != nil {
+			return err
+		}
+
+		if err := r.step(ctx, "metadata_checked"); err != nil {
+			return err
+		}
+	}
+
+	// Run the commands checking the instance is usable
+
+	if len(r.module.Commands) > 0 {
+		if err := runCommands(ctx, r, address, config); err != nil {
+			return err
+		}
+
+		if err := r.step(ctx, "commands_run"); err != nil {
+			return err
+		}
+	}
+
+	// Reboot, stop and start, and resize the server
+
+	if r.module.Lifecycle {
+		if err := runLifecycle(ctx, r, computeClient, server.ID, address, hostKeys, *privateKey); err != nil {
+			return err
+		}
+	}
+
+	// Attach, use and detach an extra volume
+
+	if r.module.VolumeAttach {
+		if err := volumeAttach(ctx, r, provider, computeClient, server.ID, resourceName, address, config); err != nil {
+			return err
+		}
+	}
+
+	if err := r.step(ctx, "end"); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func spawnMain(ctx context.Context, registry *prometheus.Registry) {
-	success := prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: program + "_spawn",
-		Name:      "success",
-		Help:      "'1' when an OpenStack instance was booted from volume and successfully ssh'ed into",
-	},
-		[]string{"error"},
-	)
-
-	timing := prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: program + "_spawn",
-		Name:      "timing",
-		Help:      "Timestamp of each step for booting on OpenStack instance from volume",
-	},
-		[]string{
-			"step",
-		},
-	)
+type spawnProbe struct{}
 
-	registry.MustRegister(success)
-	registry.MustRegister(timing)
+func init() {
+	registerProbe(spawnProbe{}, 5*time.Minute, true)
+}
 
-	c1 := make(chan error, 1)
-	go func() {
-		c1 <- spawnInstance(ctx, *timing)
-	}()
+func (spawnProbe) Name() string {
+	return "spawn"
+}
 
-	select {
-	case err := <-c1:
-		if err != nil {
-			log.Printf("ERROR: %s\n", err)
-			success.WithLabelValues(fmt.Sprintf("%s", err)).Set(0)
-		} else {
-			success.WithLabelValues("").Set(1)
-		}
-	case <-ctx.Done():
-		log.Println("ERROR: request timeout reached")
-		success.WithLabelValues(fmt.Sprintf("request timeout reached")).Set(0)
+func (spawnProbe) Description() probeDescription {
+	return probeDescription{
+		success: "'1' when an OpenStack instance was booted from volume and successfully ssh'ed into",
+		timing:  "Timestamp of each step for booting on OpenStack instance from volume",
 	}
 }
+
+func (spawnProbe) Run(ctx context.Context, r *probeRun) error {
+	return spawnInstance(ctx, r)
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSpawnFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(f *fakeCloud, module *moduleConfig)
+		reason string
+		step   string
+	}{
+		{
+			name: "authentication refused",
+			setup: func(f *fakeCloud, module *moduleConfig) {
+				f.fail(http.MethodPost, "/identity/v3/auth/tokens", http.StatusUnauthorized, `{"error":{"code":401}}`)
+			},
+			reason: reasonAuth,
+			step:   "start",
+		},
+		{
+			name: "image not found",
+			setup: func(f *fakeCloud, module *moduleConfig) {
+				module.Image = "missing"
+			},
+			reason: reasonNotFound,
+			step:   "auth_ok",
+		},
+		{
+			name: "floating IP quota exceeded",
+			setup: func(f *fakeCloud, module *moduleConfig) {
+				f.fail(http.MethodPost, "/network/v2.0/floatingips", http.StatusConflict, `{"NeutronError":{"message":"Quota exceeded for resources: ['floatingip']."}}`)
+			},
+			reason: reasonQuotaExceeded,
+			step:   "external_network_id",
+		},
+		{
+			name: "volume API failure",
+			setup: func(f *fakeCloud, module *moduleConfig) {
+				f.fail(http.MethodPost, "/volume/v2/project-1/volumes", http.StatusInternalServerError, `{}`)
+			},
+			reason: reasonAPI5xx,
+			step:   "floating_ip_created",
+		},
+		{
+			name: "volume in error",
+			setup: func(f *fakeCloud, module *moduleConfig) {
+				f.volumes.transitions = []string{"creating", "error"}
+			},
+			reason: reasonResourceError,
+			step:   "volume_created",
+		},
+		{
+			name: "server in error",
+			setup: func(f *fakeCloud, module *moduleConfig) {
+				f.servers.transitions = []string{"BUILD", "ERROR"}
+			},
+			reason: reasonResourceError,
+			step:   "server_created",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFakeCloud(t)
+			module := testModule("spawn")
+			test.setup(f, module)
+
+			result := runTestProbe(t, module, f.cloud())
+
+			if result.success || result.reason != test.reason || result.step != test.step {
+				t.Errorf("got %+v, want failure with reason %s after step %s", result, test.reason, test.step)
+			}
+		})
+	}
+}
+
+func TestSpawn(t *testing.T) {
+	tests := []struct {
+		bootMode string
+		// volumes is the number of volumes created by the probe
+		volumes int
+		// sourceType is the source of the block device of the server
+		sourceType string
+	}{
+		{bootMode: bootModeVolume, volumes: 1, sourceType: "volume"},
+		{bootMode: bootModeImage},
+		{bootMode: bootModeImageVolume, sourceType: "image"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.bootMode, func(t *testing.T) {
+			f, s, module := newSpawnFixture(t, "spawn")
+			module.BootMode = test.bootMode
+
+			result := runTestProbe(t, module, f.cloud())
+
+			if !result.success {
+				t.Fatalf("got %+v, want success", result)
+			}
+
+			if len(f.floatingIPs.objects) != 1 || f.floatingIPs.list()[0]["port_id"] == nil {
+				t.Errorf("floating IP not associated: %v", f.floatingIPs.list())
+			}
+
+			if rule := f.rules.list()[0]; rule["port_range_min"] != float64(s.port()) {
+				t.Errorf("security group rule does not open port %d: %v", s.port(), rule)
+			}
+
+			if len(f.volumes.objects) != test.volumes {
+				t.Errorf("got %d volumes, want %d", len(f.volumes.objects), test.volumes)
+			}
+
+			server := f.servers.list()[0]
+			sourceType := ""
+
+			if devices, ok := server["block_device_mapping_v2"].([]interface{}); ok {
+				sourceType, _ = devices[0].(map[string]interface{})["source_type"].(string)
+			}
+
+			if sourceType != test.sourceType {
+				t.Errorf("got block device source %q, want %q", sourceType, test.sourceType)
+			}
+
+			if imageRef, _ := server["imageRef"].(string); (imageRef != "") != (test.bootMode == bootModeImage) {
+				t.Errorf("unexpected image reference %q", imageRef)
+			}
+		})
+	}
+}
+
+func TestSpawnIPv6(t *testing.T) {
+	f, s, module := newSpawnFixture(t, "spawn")
+	f.ipv6Address = "2001:db8::10"
+	dialed := s.reachAt(f.ipv6Address)
+
+	module.AddressFamily = addressFamilyIPv6
+
+	result := runTestProbe(t, module, f.cloud())
+
+	if !result.success {
+		t.Fatalf("got %+v, want success", result)
+	}
+
+	want := net.JoinHostPort(f.ipv6Address, strconv.Itoa(s.port()))
+
+	for _, address := range dialed() {
+		if address != want {
+			t.Errorf("got SSH connection to %s, want %s", address, want)
+		}
+	}
+
+	if len(dialed()) == 0 {
+		t.Error("no SSH connection")
+	}
+
+	if value, ok := result.value(t, "openstack_client_spawn_success", map[string]string{"address_family": "ipv6"}); !ok || value != 1 {
+		t.Errorf("got success %v (%v) labelled with address_family=\"ipv6\", want 1", value, ok)
+	}
+
+	if len(f.floatingIPs.objects) != 0 {
+		t.Errorf("floating IPs created: %v", f.floatingIPs.list())
+	}
+}
+
+func TestSpawnIPv6Unreachable(t *testing.T) {
+	f, _, module := newSpawnFixture(t, "spawn")
+	f.ipv6Address = "2001:db8::10"
+
+	module.AddressFamily = addressFamilyIPv6
+	module.Timeout = 2 * time.Second
+
+	// The documentation address of the server cannot be reached
+	result := runTestProbe(t, module, f.cloud())
+
+	if result.success || result.step != "ssh_host_keys_retrieved" {
+		t.Errorf("got %+v, want failure after step ssh_host_keys_retrieved", result)
+	}
+
+	if _, ok := result.value(t, "openstack_client_spawn_timing", map[string]string{"step": "ipv6_address_found", "address_family": "ipv6"}); !ok {
+		t.Error("step ipv6_address_found not reached or not labelled with the address family")
+	}
+
+	if len(f.floatingIPs.objects) != 0 {
+		t.Errorf("floating IPs created: %v", f.floatingIPs.list())
+	}
+
+	if rule := f.rules.list()[0]; rule["ethertype"] != "IPv6" {
+		t.Errorf("got security group rule %v, want an IPv6 one", rule)
+	}
+}
+
+func TestGetImage(t *testing.T) {
+	f := newFakeCloud(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	provider, err := getProvider(ctx, f.cloud())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := openstack.NewImageServiceV2(provider, gophercloud.EndpointOpts{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"cirros", "image-1"} {
+		if image, err := getImage(client, name); err != nil || image.ID != "image-1" {
+			t.Errorf("%s: got %v (%v), want image-1", name, image, err)
+		}
+	}
+
+	_, err = getImage(client, "ubuntu")
+
+	if err == nil || err.Error() != "image ubuntu not found" || classifyError(ctx, err) != reasonNotFound {
+		t.Errorf("got error %v, want image ubuntu not found", err)
+	}
+}
+
+func TestGlobalIPv6Address(t *testing.T) {
+	tests := []struct {
+		addresses []string
+		want      string
+	}{
+		{addresses: []string{"10.0.0.10", "fe80::f816:3eff:fe12:3456", "2001:db8::10"}, want: "2001:db8::10"},
+		{addresses: []string{"10.0.0.10", "fe80::f816:3eff:fe12:3456"}},
+		{addresses: []string{"::1"}},
+	}
+
+	for _, test := range tests {
+		port := &ports.Port{ID: "port"}
+
+		for _, address := range test.addresses {
+			port.FixedIPs = append(port.FixedIPs, ports.IP{IPAddress: address})
+		}
+
+		got, err := globalIPv6Address(port)
+
+		if test.want == "" && err == nil {
+			t.Errorf("%v: got %s, want an error", test.addresses, got)
+		}
+
+		if test.want != "" && got != test.want {
+			t.Errorf("%v: got %s (%v), want %s", test.addresses, got, err, test.want)
+		}
+	}
+}
+
+func TestGetHostKey(t *testing.T) {
+	f := newFakeCloud(t)
+	s := newFakeSSHServer(t)
+
+	// The console is empty before the boot, then the host keys are printed
+	// once cloud-init has generated them
+	f.consoleOutput = func(server fakeObject, call int) string {
+		switch call {
+		case 1:
+			return ""
+		case 2:
+			return "Booting\n"
+		default:
+			return "Booting\n" + s.consoleOutput() + "Cloud-init finished\n"
+		}
+	}
+
+	f.servers.objects["server-1"] = fakeObject{"id": "server-1", "name": "server", "status": "ACTIVE"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	provider, err := getProvider(ctx, f.cloud())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := openstack.NewComputeV2(provider, gophercloud.EndpointOpts{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestRun(f.cloud(), testModule("spawn"))
+
+	hostKeys, err := getHostKey(ctx, client, servers.Server{ID: "server-1"}, r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s.hostKey))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hostKeys) != 1 || !bytes.Equal(hostKeys[0].Marshal(), want.Marshal()) {
+		t.Errorf("got host keys %v, want %s", hostKeys, s.hostKey)
+	}
+
+	if r.getLastStep() != "boot_started" {
+		t.Errorf("got last step %q, want boot_started", r.getLastStep())
+	}
+}
+
+func TestSSHServer(t *testing.T) {
+	otherKey, _, err := generateSSHKey()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherPublicKey, err := ssh.NewPublicKey(&otherKey.PublicKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// setup returns the host keys expected by the client
+		setup  func(s *fakeSSHServer, hostKeys []ssh.PublicKey) []ssh.PublicKey
+		reason string
+	}{
+		{
+			name: "success",
+			setup: func(s *fakeSSHServer, hostKeys []ssh.PublicKey) []ssh.PublicKey {
+				return hostKeys
+			},
+		},
+		{
+			name: "retry while booting",
+			setup: func(s *fakeSSHServer, hostKeys []ssh.PublicKey) []ssh.PublicKey {
+				s.drop = 2
+				return hostKeys
+			},
+		},
+		{
+			name: "host key mismatch",
+			setup: func(s *fakeSSHServer, hostKeys []ssh.PublicKey) []ssh.PublicKey {
+				return []ssh.PublicKey{otherPublicKey}
+			},
+			reason: reasonHostKeyMismatch,
+		},
+		{
+			name: "client key refused",
+			setup: func(s *fakeSSHServer, hostKeys []ssh.PublicKey) []ssh.PublicKey {
+				s.authorizedKey = otherPublicKey
+				return hostKeys
+			},
+			reason: reasonSSHAuth,
+		},
+		{
+			name: "server unreachable",
+			setup: func(s *fakeSSHServer, hostKeys []ssh.PublicKey) []ssh.PublicKey {
+				s.listener.Close()
+				return hostKeys
+			},
+			reason: reasonSSHConnection,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newFakeSSHServer(t)
+
+			hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s.hostKey))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hostKeys := test.setup(s, []ssh.PublicKey{hostKey})
+
+			privateKey, _, err := generateSSHKey()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			err = sshServer(ctx, s.address(), "ubuntu", hostKeys, *privateKey)
+
+			switch {
+			case test.reason == "" && err != nil:
+				t.Errorf("got error %s, want success", err)
+			case test.reason != "" && err == nil:
+				t.Errorf("got success, want failure with reason %s", test.reason)
+			case test.reason != "" && classifyError(context.Background(), err) != test.reason:
+				t.Errorf("got reason %s for %s, want %s", classifyError(context.Background(), err), err, test.reason)
+			}
+
+			if s.drop > 0 && s.connectionCount() <= s.drop {
+				t.Errorf("got %d connections, want more than %d", s.connectionCount(), s.drop)
+			}
+		})
+	}
+}
+
+// newTestRun returns a run of module against cloud whose metrics are discarded
+func newTestRun(cloud *cloudConfig, module *moduleConfig) *probeRun {
+	gauge := func() *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test"}, []string{"step"})
+	}
+
+	start := time.Now()
+
+	return &probeRun{
+		cloud:    cloud,
+		module:   module,
+		registry: prometheus.NewRegistry(),
+		timing:   gauge(),
+		duration: gauge(),
+		elapsed:  gauge(),
+		start:    start,
+		last:     start,
+	}
+}
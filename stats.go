@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// probeStatus is the history of the runs of a probe against a cloud
+type probeStatus struct {
+	cloud string
+	probe string
+	// variant holds the values of the variantLabels of the runs
+	variant []string
+
+	runs                float64
+	failures            map[string]float64
+	consecutiveFailures float64
+	lastSuccess         time.Time
+	// lastFailedStep is the step after which the last run failed
+	lastFailedStep string
+}
+
+// probeStats keeps the history of every probe across runs, it is registered
+// in the long-lived registry of the exporter unlike the metrics of each run
+type probeStats struct {
+	mutex    sync.Mutex
+	statuses map[string]*probeStatus
+
+	runsDesc                *prometheus.Desc
+	failuresDesc            *prometheus.Desc
+	consecutiveFailuresDesc *prometheus.Desc
+	lastSuccessDesc         *prometheus.Desc
+	lastFailedStepDesc      *prometheus.Desc
+}
+
+var stats = newProbeStats()
+
+func newProbeStats() *probeStats {
+	return &probeStats{
+		statuses: map[string]*probeStatus{},
+		runsDesc: prometheus.NewDesc(
+			program+"_probe_runs_total",
+			"Number of completed runs of each probe",
+			append([]string{"cloud", "probe"}, variantLabels...),
+			nil,
+		),
+		failuresDesc: prometheus.NewDesc(
+			program+"_probe_failures_total",
+			"Number of failed runs of each probe by reason",
+			append(append([]string{"cloud", "probe"}, variantLabels...), "reason"),
+			nil,
+		),
+		consecutiveFailuresDesc: prometheus.NewDesc(
+			program+"_probe_consecutive_failures",
+			"Number of runs of each probe which failed since its last success",
+			append([]string{"cloud", "probe"}, variantLabels...),
+			nil,
+		),
+		lastSuccessDesc: prometheus.NewDesc(
+			program+"_probe_last_success_timestamp_seconds",
+			"Timestamp of the end of the last successful run of each probe",
+			append([]string{"cloud", "probe"}, variantLabels...),
+			nil,
+		),
+		lastFailedStepDesc: prometheus.NewDesc(
+			program+"_probe_last_failed_step",
+			"'1' for the step after which the last run of each probe failed, absent when it succeeded",
+			append(append([]string{"cloud", "probe"}, variantLabels...), "step"),
+			nil,
+		),
+	}
+}
+
+// record accounts for a completed run, reason and step being empty on success.
+// The runs of each variant of a probe are accounted apart.
+func (s *probeStats) record(cloud string, probe string, variant []string, reason string, step string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := cloud + "/" + probe + "/" + strings.Join(variant, "/")
+	status, ok := s.statuses[key]
+
+	if !ok {
+		status = &probeStatus{
+			cloud:    cloud,
+			probe:    probe,
+			variant:  variant,
+			failures: map[string]float64{},
+		}
+		s.statuses[key] = status
+	}
+
+	status.runs++
+
+	if reason == "" {
+		status.consecutiveFailures = 0
+		status.lastSuccess = time.Now()
+		status.lastFailedStep = ""
+	} else {
+		status.failures[reason]++
+		status.consecutiveFailures++
+		status.lastFailedStep = step
+	}
+}
+
+// Describe implements prometheus.Collector
+func (s *probeStats) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.runsDesc
+	ch <- s.failuresDesc
+	ch <- s.consecutiveFailuresDesc
+	ch <- s.lastSuccessDesc
+	ch <- s.lastFailedStepDesc
+}
+
+// Collect implements prometheus.Collector
+func (s *probeStats) Collect(ch chan<- prometheus.Metric) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, status := range s.statuses {
+		ch <- prometheus.MustNewConstMetric(s.runsDesc, prometheus.CounterValue, status.runs, status.labels()...)
+		ch <- prometheus.MustNewConstMetric(s.consecutiveFailuresDesc, prometheus.GaugeValue, status.consecutiveFailures, status.labels()...)
+
+		for reason, failures := range status.failures {
+			ch <- prometheus.MustNewConstMetric(s.failuresDesc, prometheus.CounterValue, failures, status.labels(reason)...)
+		}
+
+		if !status.lastSuccess.IsZero() {
+			ch <- prometheus.MustNewConstMetric(s.lastSuccessDesc, prometheus.GaugeValue, float64(status.lastSuccess.UnixNano())/1e9, status.labels()...)
+		}
+
+		if status.consecutiveFailures > 0 {
+			ch <- prometheus.MustNewConstMetric(s.lastFailedStepDesc, prometheus.GaugeValue, 1, status.labels(status.lastFailedStep)...)
+		}
+	}
+}
+
+// labels returns the label values of the metrics of status followed by extra
+func (status *probeStatus) labels(extra ...string) []string {
+	return append(append([]string{status.cloud, status.probe}, status.variant...), extra...)
+}
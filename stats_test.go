@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestProbeStats(t *testing.T) {
+	// run is the outcome of a run, reason and step being empty on success
+	type run struct {
+		variant []string
+		reason  string
+		step    string
+	}
+
+	success := run{variant: []string{"", "", ""}}
+
+	tests := []struct {
+		name string
+		runs []run
+		want string
+		// lastSuccess tells whether a last success timestamp is exported
+		lastSuccess bool
+	}{
+		{
+			name: "failures by reason",
+			runs: []run{
+				{variant: []string{"", "", ""}, reason: reasonTimeout, step: "ssh_successful"},
+				{variant: []string{"", "", ""}, reason: reasonTimeout, step: "ssh_successful"},
+				{variant: []string{"", "", ""}, reason: reasonAPI5xx, step: "auth_ok"},
+			},
+			want: `
+# HELP openstack_client_probe_runs_total Number of completed runs of each probe
+# TYPE openstack_client_probe_runs_total counter
+openstack_client_probe_runs_total{availability_zone="",cloud="region1",flavor="",image="",probe="spawn"} 3
+# HELP openstack_client_probe_failures_total Number of failed runs of each probe by reason
+# TYPE openstack_client_probe_failures_total counter
+openstack_client_probe_failures_total{availability_zone="",cloud="region1",flavor="",image="",probe="spawn",reason="api_5xx"} 1
+openstack_client_probe_failures_total{availability_zone="",cloud="region1",flavor="",image="",probe="spawn",reason="timeout"} 2
+# HELP openstack_client_probe_consecutive_failures Number of runs of each probe which failed since its last success
+# TYPE openstack_client_probe_consecutive_failures gauge
+openstack_client_probe_consecutive_failures{availability_zone="",cloud="region1",flavor="",image="",probe="spawn"} 3
+# HELP openstack_client_probe_last_failed_step '1' for the step after which the last run of each probe failed, absent when it succeeded
+# TYPE openstack_client_probe_last_failed_step gauge
+openstack_client_probe_last_failed_step{availability_zone="",cloud="region1",flavor="",image="",probe="spawn",step="auth_ok"} 1
+`,
+		},
+		{
+			name: "reset on success",
+			runs: []run{
+				{variant: []string{"", "", ""}, reason: reasonTimeout, step: "ssh_successful"},
+				success,
+			},
+			want: `
+# HELP openstack_client_probe_runs_total Number of completed runs of each probe
+# TYPE openstack_client_probe_runs_total counter
+openstack_client_probe_runs_total{availability_zone="",cloud="region1",flavor="",image="",probe="spawn"} 2
+# HELP openstack_client_probe_failures_total Number of failed runs of each probe by reason
+# TYPE openstack_client_probe_failures_total counter
+openstack_client_probe_failures_total{availability_zone="",cloud="region1",flavor="",image="",probe="spawn",reason="timeout"} 1
+# HELP openstack_client_probe_consecutive_failures Number of runs of each probe which failed since its last success
+# TYPE openstack_client_probe_consecutive_failures gauge
+openstack_client_probe_consecutive_failures{availability_zone="",cloud="region1",flavor="",image="",probe="spawn"} 0
+`,
+			lastSuccess: true,
+		},
+		{
+			name: "variants apart",
+			runs: []run{
+				{variant: []string{"az1", "", ""}, reason: reasonResourceError, step: "server_created"},
+				{variant: []string{"az2", "", ""}},
+			},
+			want: `
+# HELP openstack_client_probe_runs_total Number of completed runs of each probe
+# TYPE openstack_client_probe_runs_total counter
+openstack_client_probe_runs_total{availability_zone="az1",cloud="region1",flavor="",image="",probe="spawn"} 1
+openstack_client_probe_runs_total{availability_zone="az2",cloud="region1",flavor="",image="",probe="spawn"} 1
+# HELP openstack_client_probe_failures_total Number of failed runs of each probe by reason
+# TYPE openstack_client_probe_failures_total counter
+openstack_client_probe_failures_total{availability_zone="az1",cloud="region1",flavor="",image="",probe="spawn",reason="resource_error"} 1
+# HELP openstack_client_probe_consecutive_failures Number of runs of each probe which failed since its last success
+# TYPE openstack_client_probe_consecutive_failures gauge
+openstack_client_probe_consecutive_failures{availability_zone="az1",cloud="region1",flavor="",image="",probe="spawn"} 1
+openstack_client_probe_consecutive_failures{availability_zone="az2",cloud="region1",flavor="",image="",probe="spawn"} 0
+# HELP openstack_client_probe_last_failed_step '1' for the step after which the last run of each probe failed, absent when it succeeded
+# TYPE openstack_client_probe_last_failed_step gauge
+openstack_client_probe_last_failed_step{availability_zone="az1",cloud="region1",flavor="",image="",probe="spawn",step="server_created"} 1
+`,
+			lastSuccess: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newProbeStats()
+
+			for _, run := range test.runs {
+				s.record("region1", "spawn", run.variant, run.reason, run.step)
+			}
+
+			err := testutil.CollectAndCompare(s, strings.NewReader(test.want),
+				"openstack_client_probe_runs_total",
+				"openstack_client_probe_failures_total",
+				"openstack_client_probe_consecutive_failures",
+				"openstack_client_probe_last_failed_step",
+			)
+
+			if err != nil {
+				t.Error(err)
+			}
+
+			// The timestamp of the last success depends on the time of the run
+			if got := testutil.CollectAndCompare(s, strings.NewReader(""), "openstack_client_probe_last_success_timestamp_seconds") != nil; got != test.lastSuccess {
+				t.Errorf("got last success timestamp %v, want %v", got, test.lastSuccess)
+			}
+		})
+	}
+}
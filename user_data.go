@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/acceptance/tools"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ssh"
+)
+
+// userDataFile is written by the user-data script with the nonce of the run
+const userDataFile = "/var/tmp/openstack-client-exporter-user-data"
+
+// userDataMarker matches the line printed by the user-data script, which
+// cloud-init sends to the console, with its nonce and the time it completed
+var userDataMarker = regexp.MustCompile(`openstack-client-exporter user-data (\S+) completed at (\d+)`)
+
+// newUserData returns a nonce unique to the run and the user-data script
+// writing it to userDataFile then printing it to the console
+func newUserData() (string, []byte) {
+	nonce := tools.RandomString("", 16)
+
+	script := "#!/bin/sh\n" +
+		"echo " + nonce + " > " + userDataFile + "\n" +
+		"echo \"openstack-client-exporter user-data " + nonce + " completed at $(date +%s)\"\n"
+
+	return nonce, []byte(script)
+}
+
+// checkUserData waits for the marker of the user-data script holding nonce on
+// the console of the server, then reads the file written by the script over
+// SSH to address. The time at which the script completed, as printed by the
+// instance, is exported.
+func checkUserData(ctx context.Context, r *probeRun, computeClient *gophercloud.ServiceClient, serverID string, address string, config *ssh.ClientConfig, nonce string) error {
+	completed := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   program + "_" + r.module.Prober,
+		Name:        "user_data_completed_timestamp_seconds",
+		Help:        "Timestamp at which the user-data script completed, according to the clock of the instance",
+		ConstLabels: r.labels,
+	})
+
+	r.registry.MustRegister(completed)
+
+	for {
+		consoleOutput, err := servers.ShowConsoleOutput(computeClient, serverID, servers.ShowConsoleOutputOpts{}).Extract()
+
+		if err != nil {
+			log.Printf("Failed to get console output: %s\n", err)
+		}
+
+		if match := findUserDataMarker(consoleOutput, nonce); match != nil {
+			timestamp, _ := strconv.ParseInt(match[2], 10, 64)
+			completed.Set(float64(timestamp))
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout while waiting for the user-data marker on the console")
+		default:
+		}
+
+		time.Sleep(1 * time.Second)
+	}
+
+	if err := r.step(ctx, "user_data_marker_found"); err != nil {
+		return err
+	}
+
+	client, err := sshDial(ctx, address, config)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	stdout, code, err := runCommand(client, "cat "+userDataFile)
+
+	if err != nil {
+		return err
+	}
+
+	if code != 0 {
+		return withReason(reasonUserData, fmt.Errorf("cannot read %s: exit code %d", userDataFile, code))
+	}
+
+	if content := strings.TrimSpace(stdout); content != nonce {
+		return withReason(reasonUserData, fmt.Errorf("got %q in %s, want %q", content, userDataFile, nonce))
+	}
+
+	if err := r.step(ctx, "user_data_file_checked"); err != nil {
+		return err
+	}
+
+	log.Printf("User-data of server %s completed", serverID)
+
+	return nil
+}
+
+// findUserDataMarker returns the submatches of the user-data marker holding
+// nonce in consoleOutput, nil if there is none
+func findUserDataMarker(consoleOutput string, nonce string) []string {
+	for _, match := range userDataMarker.FindAllStringSubmatch(consoleOutput, -1) {
+		if match[1] == nonce {
+			return match
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSpawnUserData(t *testing.T) {
+	tests := []struct {
+		name string
+		// marker and file tell whether the user-data script printed its
+		// marker and wrote its file
+		marker bool
+		file   bool
+		reason string
+		step   string
+	}{
+		{
+			name:   "executed",
+			marker: true,
+			file:   true,
+		},
+		{
+			name:   "no marker",
+			file:   true,
+			reason: reasonTimeout,
+			step:   "ssh_successful",
+		},
+		{
+			name:   "no file",
+			marker: true,
+			reason: reasonUserData,
+			step:   "user_data_marker_found",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, s, module := newSpawnFixture(t, "spawn")
+			completed := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+
+			// nonce returns the nonce written by the user-data script of server
+			nonce := func(server fakeObject) string {
+				script, _ := base64.StdEncoding.DecodeString(server["user_data"].(string))
+				return regexp.MustCompile(`echo (\S+) > `).FindStringSubmatch(string(script))[1]
+			}
+
+			f.consoleOutput = func(server fakeObject, call int) string {
+				output := s.consoleOutput()
+
+				if test.marker {
+					output = fmt.Sprintf("openstack-client-exporter user-data %s completed at %d\n", nonce(server), completed) + output
+				}
+
+				return output
+			}
+
+			s.exec = func(command string) (string, uint32) {
+				switch {
+				case command == "/usr/bin/whoami":
+					return "ubuntu\n", 0
+				case command == "cat "+userDataFile && test.file:
+					f.mutex.Lock()
+					defer f.mutex.Unlock()
+
+					return nonce(f.servers.list()[0]) + "\n", 0
+				}
+
+				return "", 1
+			}
+
+			module.UserData = true
+			module.Timeout = 3 * time.Second
+
+			result := runTestProbe(t, module, f.cloud())
+
+			if test.reason != "" {
+				if result.success || result.reason != test.reason || result.step != test.step {
+					t.Errorf("got %+v, want failure with reason %s after step %s", result, test.reason, test.step)
+				}
+
+				return
+			}
+
+			if !result.success {
+				t.Fatalf("got %+v, want success", result)
+			}
+
+			if value, ok := result.value(t, "openstack_client_spawn_user_data_completed_timestamp_seconds", nil); !ok || value != float64(completed) {
+				t.Errorf("got completion timestamp %v (%v), want %d", value, ok, completed)
+			}
+		})
+	}
+}
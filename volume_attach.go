@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/volumeattach"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// listDisksCommand lists the block devices of the instance, the device
+	// reported by Nova is not reliable with virtio so the attached volume is
+	// found as the disk missing before the attachment
+	listDisksCommand = "lsblk -dn -o NAME"
+	// writeVolumeCommand formats the device, writes random data to it and
+	// prints the checksum of the data
+	writeVolumeCommand = "sudo sh -c 'mkfs.ext4 -q /dev/%s && mkdir -p /mnt/probe && mount /dev/%s /mnt/probe && head -c 1048576 /dev/urandom > /mnt/probe/data && sha256sum /mnt/probe/data && umount /mnt/probe'"
+	// readVolumeCommand prints the checksum of the data written to the device
+	// by writeVolumeCommand
+	readVolumeCommand = "sudo sh -c 'mkdir -p /mnt/probe && mount /dev/%s /mnt/probe && sha256sum /mnt/probe/data && umount /mnt/probe'"
+)
+
+// volumeAttach creates a volume, attaches it to the server reachable over SSH
+// to address, checks the instance sees it, formats and writes to it, then
+// detaches it
+func volumeAttach(ctx context.Context, r *probeRun, provider *gophercloud.ProviderClient, computeClient *gophercloud.ServiceClient, serverID string, name string, address string, config *ssh.ClientConfig) error {
+	volumeClient, err := openstack.NewBlockStorageV2(provider, r.cloud.endpointOpts())
+
+	if err != nil {
+		return fmt.Errorf("cinder client failure: %w", err)
+	}
+
+	volume, err := createVolume(ctx, r, provider, name, volumes.CreateOpts{}, "data_")
+
+	if err != nil {
+		return err
+	}
+
+	client, err := sshDial(ctx, address, config)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	device, err := attachVolume(ctx, r, computeClient, volumeClient, client, serverID, volume.ID, "data_volume_")
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := writeVolume(ctx, r, client, volume.ID, device, "data_volume_"); err != nil {
+		return err
+	}
+
+	return detachVolume(ctx, r, computeClient, volumeClient, serverID, volume.ID, "data_volume_")
+}
+
+// attachVolume attaches the volume to the server reachable with client and
+// returns the name of its disk in the instance. It records the steps
+// <stepPrefix>attached and <stepPrefix>device_found.
+func attachVolume(ctx context.Context, r *probeRun, computeClient *gophercloud.ServiceClient, volumeClient *gophercloud.ServiceClient, client *ssh.Client, serverID string, volumeID string, stepPrefix string) (string, error) {
+	disks, err := listDisks(client)
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = volumeattach.Create(computeClient, serverID, volumeattach.CreateOpts{VolumeID: volumeID}).Extract()
+
+	if err != nil {
+		return "", fmt.Errorf("volume attachment failed: %w", err)
+	}
+
+	if _, err := waitVolume(ctx, volumeClient, volumeID, "in-use"); err != nil {
+		return "", err
+	}
+
+	if err := r.step(ctx, stepPrefix+"attached"); err != nil {
+		return "", err
+	}
+
+	log.Printf("Volume %s attached to server %s", volumeID, serverID)
+
+	device, err := waitDisk(ctx, client, disks)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := r.step(ctx, stepPrefix+"device_found"); err != nil {
+		return "", err
+	}
+
+	log.Printf("Volume %s found as /dev/%s", volumeID, device)
+
+	return device, nil
+}
+
+// writeVolume formats device and writes random data to it, it returns the
+// checksum of the data and records the step <stepPrefix>written
+func writeVolume(ctx context.Context, r *probeRun, client *ssh.Client, volumeID string, device string, stepPrefix string) (string, error) {
+	checksum, err := volumeChecksum(ctx, client, fmt.Sprintf(writeVolumeCommand, device, device))
+
+	if err != nil {
+		return "", fmt.Errorf("failed to write to the volume: %w", err)
+	}
+
+	if err := r.step(ctx, stepPrefix+"written"); err != nil {
+		return "", err
+	}
+
+	log.Printf("Volume %s written, checksum %s", volumeID, checksum)
+
+	return checksum, nil
+}
+
+// volumeChecksum runs command, writing or reading the volume, and returns the
+// checksum it prints
+func volumeChecksum(ctx context.Context, client *ssh.Client, command string) (string, error) {
+	stdout, code, err := runCommand(client, command)
+
+	if ctx.Err() != nil {
+		return "", withReason(reasonTimeout, fmt.Errorf("timeout while accessing the volume"))
+	}
+
+	if err == nil && code != 0 {
+		err = fmt.Errorf("exit code %d, output: %q", code, stdout)
+	}
+
+	if err == nil && len(strings.Fields(stdout)) == 0 {
+		err = fmt.Errorf("no checksum printed")
+	}
+
+	if err != nil {
+		return "", withReason(reasonCommandFailed, err)
+	}
+
+	return strings.Fields(stdout)[0], nil
+}
+
+// detachVolume detaches the volume from the server and records the step
+// <stepPrefix>detached, Nova identifies the attachment by the volume ID
+func detachVolume(ctx context.Context, r *probeRun, computeClient *gophercloud.ServiceClient, volumeClient *gophercloud.ServiceClient, serverID string, volumeID string, stepPrefix string) error {
+	if err := volumeattach.Delete(computeClient, serverID, volumeID).ExtractErr(); err != nil {
+		return fmt.Errorf("volume detachment failed: %w", err)
+	}
+
+	if _, err := waitVolume(ctx, volumeClient, volumeID, "available"); err != nil {
+		return err
+	}
+
+	if err := r.step(ctx, stepPrefix+"detached"); err != nil {
+		return err
+	}
+
+	log.Printf("Volume %s detached from server %s", volumeID, serverID)
+
+	return nil
+}
+
+// listDisks returns the names of the disks of the instance
+func listDisks(client *ssh.Client) ([]string, error) {
+	stdout, code, err := runCommand(client, listDisksCommand)
+
+	if err == nil && code != 0 {
+		err = fmt.Errorf("exit code %d", code)
+	}
+
+	if err != nil {
+		return nil, withReason(reasonCommandFailed, fmt.Errorf("failed to list disks: %w", err))
+	}
+
+	return strings.Fields(stdout), nil
+}
+
+// waitDisk waits until a disk missing from disks shows up in the instance and
+// returns its name
+func waitDisk(ctx context.Context, client *ssh.Client, disks []string) (string, error) {
+	for {
+		current, err := listDisks(client)
+
+		if err != nil && ctx.Err() == nil {
+			return "", err
+		}
+
+		for _, disk := range current {
+			if !contains(disks, disk) {
+				return disk, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", withReason(reasonTimeout, fmt.Errorf("timeout waiting for the volume to show up in the instance"))
+		default:
+		}
+
+		time.Sleep(1 * time.Second)
+	}
+}
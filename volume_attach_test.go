@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSpawnVolumeAttach(t *testing.T) {
+	tests := []struct {
+		name string
+		// device tells whether the attached volume shows up in the instance
+		device bool
+		// writeCode is the exit code of the write to the volume
+		writeCode uint32
+		reason    string
+		step      string
+	}{
+		{name: "success", device: true},
+		{name: "device missing", reason: reasonTimeout, step: "data_volume_attached"},
+		{name: "write failure", device: true, writeCode: 1, reason: reasonCommandFailed, step: "data_volume_device_found"},
+	}
+
+	for _, test := range tests {
+		// The SSH server of a run may outlive it, it keeps its own test
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			f, s, module := newSpawnFixture(t, "spawn")
+
+			s.exec = func(command string) (string, uint32) {
+				switch command {
+				case "/usr/bin/whoami":
+					return "ubuntu\n", 0
+				case listDisksCommand:
+					f.mutex.Lock()
+					defer f.mutex.Unlock()
+
+					for _, volume := range f.volumes.list() {
+						if volume["status"] == "in-use" && test.device {
+							return "vda\nvdb\n", 0
+						}
+					}
+
+					return "vda\n", 0
+				case fmt.Sprintf(writeVolumeCommand, "vdb", "vdb"):
+					return "9d5ed678fe57bcca610140957afab571  /mnt/probe/data\n", test.writeCode
+				default:
+					return "", 127
+				}
+			}
+
+			module.BootMode = bootModeImage
+			module.VolumeAttach = true
+
+			if test.reason == reasonTimeout {
+				module.Timeout = 3 * time.Second
+			}
+
+			result := runTestProbe(t, module, f.cloud())
+
+			switch {
+			case test.reason == "" && !result.success:
+				t.Errorf("got %+v, want success", result)
+			case test.reason != "" && (result.success || result.reason != test.reason || result.step != test.step):
+				t.Errorf("got %+v, want failure with reason %s after step %s", result, test.reason, test.step)
+			}
+
+			if len(f.volumes.objects) != 1 {
+				t.Fatalf("got %d volumes, want 1", len(f.volumes.objects))
+			}
+
+			if status := f.volumes.list()[0]["status"]; test.reason == "" && status != "available" {
+				t.Errorf("got volume status %v, want available once detached", status)
+			}
+
+			if _, ok := result.value(t, "openstack_client_spawn_step_duration_seconds", map[string]string{"step": "data_volume_detached"}); ok != (test.reason == "") {
+				t.Errorf("got duration of step data_volume_detached %v, want %v", ok, test.reason == "")
+			}
+		})
+	}
+}
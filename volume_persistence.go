@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
+)
+
+func volumePersistence(ctx context.Context, r *probeRun) error {
+	if err := r.step(ctx, "start"); err != nil {
+		return err
+	}
+
+	resourceName := createName()
+	log.Printf("volumePersistence using resource name %s\n", resourceName)
+
+	provider, err := getProvider(ctx, r.cloud)
+
+	if err != nil {
+		return err
+	}
+
+	if err := r.step(ctx, "auth_ok"); err != nil {
+		return err
+	}
+
+	// Boot two servers on different hypervisors, so that the volume is
+	// attached through two different hosts
+
+	g, err := bootInstances(ctx, r, provider, resourceName, []string{"a", "b"}, nil)
+
+	if err != nil {
+		return err
+	}
+
+	// Create the empty volume the data is written to
+
+	volumeClient, err := openstack.NewBlockStorageV2(provider, r.cloud.endpointOpts())
+
+	if err != nil {
+		return fmt.Errorf("cinder client failure: %w", err)
+	}
+
+	volume, err := createVolume(ctx, r, provider, resourceName, volumes.CreateOpts{}, "")
+
+	if err != nil {
+		return err
+	}
+
+	// Write random data to the volume from the first server, then detach it
+
+	writer, reader := g.instances[0], g.instances[1]
+	client, err := g.dial(ctx, r, writer)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	prefix := "volume_" + writer.name + "_"
+	device, err := attachVolume(ctx, r, g.computeClient, volumeClient, client, writer.server.ID, volume.ID, prefix)
+
+	if err != nil {
+		return err
+	}
+
+	written, err := writeVolume(ctx, r, client, volume.ID, device, prefix)
+
+	if err != nil {
+		return err
+	}
+
+	if err := detachVolume(ctx, r, g.computeClient, volumeClient, writer.server.ID, volume.ID, prefix); err != nil {
+		return err
+	}
+
+	// Attach the volume to the second server and read the data back
+
+	client, err = g.dial(ctx, r, reader)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	prefix = "volume_" + reader.name + "_"
+	device, err = attachVolume(ctx, r, g.computeClient, volumeClient, client, reader.server.ID, volume.ID, prefix)
+
+	if err != nil {
+		return err
+	}
+
+	read, err := volumeChecksum(ctx, client, fmt.Sprintf(readVolumeCommand, device))
+
+	if err != nil {
+		return fmt.Errorf("failed to read the volume: %w", err)
+	}
+
+	if read != written {
+		return withReason(reasonDataCorruption, fmt.Errorf("volume %s read from server %s with checksum %s, written with %s", volume.ID, reader.name, read, written))
+	}
+
+	if err := r.step(ctx, "checksum_verified"); err != nil {
+		return err
+	}
+
+	log.Printf("Volume %s read with the checksum written", volume.ID)
+
+	if err := r.step(ctx, "end"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type volumePersistenceProbe struct{}
+
+func init() {
+	registerProbe(volumePersistenceProbe{}, 10*time.Minute, false)
+}
+
+func (volumePersistenceProbe) Name() string {
+	return "volume_persistence"
+}
+
+func (volumePersistenceProbe) Description() probeDescription {
+	return probeDescription{
+		success: "'1' when data written to a volume from an OpenStack instance was read back from another instance",
+		timing:  "Timestamp of each step for writing to a volume and reading it back from another instance",
+	}
+}
+
+func (volumePersistenceProbe) Run(ctx context.Context, r *probeRun) error {
+	return volumePersistence(ctx, r)
+}
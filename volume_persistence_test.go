@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestVolumePersistence(t *testing.T) {
+	tests := []struct {
+		name string
+		// checksum is the checksum of the data read from the volume
+		checksum string
+		reason   string
+	}{
+		{name: "data read back", checksum: "9d5ed678fe57bcca610140957afab571"},
+		{name: "data corrupted", checksum: "0cc175b9c0f1b6a831c399e269772661", reason: reasonDataCorruption},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, s, module := newSpawnFixture(t, "volume_persistence")
+
+			s.exec = func(command string) (string, uint32) {
+				switch command {
+				case "/usr/bin/whoami":
+					return "ubuntu\n", 0
+				case listDisksCommand:
+					f.mutex.Lock()
+					defer f.mutex.Unlock()
+
+					if volume := f.volumes.list()[0]; volume["status"] == "in-use" {
+						return "vda\nvdb\n", 0
+					}
+
+					return "vda\n", 0
+				case fmt.Sprintf(writeVolumeCommand, "vdb", "vdb"):
+					return "9d5ed678fe57bcca610140957afab571  /mnt/probe/data\n", 0
+				case fmt.Sprintf(readVolumeCommand, "vdb"):
+					return test.checksum + "  /mnt/probe/data\n", 0
+				default:
+					return "", 127
+				}
+			}
+
+			// Booting from the image leaves the data volume alone in Cinder
+			module.BootMode = bootModeImage
+
+			result := runTestProbe(t, module, f.cloud())
+
+			switch {
+			case test.reason == "" && !result.success:
+				t.Errorf("got %+v, want success", result)
+			case test.reason != "" && (result.success || result.reason != test.reason || result.step != "volume_b_device_found"):
+				t.Errorf("got %+v, want failure with reason %s after step volume_b_device_found", result, test.reason)
+			}
+
+			if len(f.servers.objects) != 2 || len(f.volumes.objects) != 1 {
+				t.Fatalf("got %d servers and %d volumes, want 2 and 1", len(f.servers.objects), len(f.volumes.objects))
+			}
+
+			var reader string
+
+			for _, server := range f.servers.list() {
+				if strings.HasSuffix(server["name"].(string), "-b") {
+					reader = server["id"].(string)
+				}
+			}
+
+			attachments, _ := f.volumes.list()[0]["attachments"].([]fakeObject)
+
+			if len(attachments) != 1 || attachments[0]["server_id"] != reader {
+				t.Errorf("got attachments %v, want the volume attached to server b", attachments)
+			}
+
+			for _, step := range []string{"volume_a_written", "volume_a_detached", "volume_b_attached"} {
+				if _, ok := result.value(t, "openstack_client_volume_persistence_step_duration_seconds", map[string]string{"step": step}); !ok {
+					t.Errorf("step %s not reached", step)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v2/snapshots"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
+)
+
+func volumeSnapshot(ctx context.Context, r *probeRun) error {
+	if err := r.step(ctx, "start"); err != nil {
+		return err
+	}
+
+	resourceName := createName()
+	log.Printf("volumeSnapshot using resource name %s\n", resourceName)
+
+	provider, err := getProvider(ctx, r.cloud)
+
+	if err != nil {
+		return err
+	}
+
+	if err := r.step(ctx, "auth_ok"); err != nil {
+		return err
+	}
+
+	volumeClient, err := openstack.NewBlockStorageV2(provider, r.cloud.endpointOpts())
+
+	if err != nil {
+		return fmt.Errorf("cinder client failure: %w", err)
+	}
+
+	// Create the source volume and take a snapshot of it
+
+	volume, err := createVolume(ctx, r, provider, resourceName, volumes.CreateOpts{}, "")
+
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := snapshots.Create(volumeClient, snapshots.CreateOpts{
+		VolumeID: volume.ID,
+		Name:     resourceName,
+	}).Extract()
+
+	if err != nil {
+		return fmt.Errorf("snapshot creation failed: %w", err)
+	}
+
+	if err := r.step(ctx, "snapshot_created"); err != nil {
+		return err
+	}
+
+	log.Printf("Snapshot created %s\n", snapshot.ID)
+
+	if err := waitSnapshot(ctx, volumeClient, snapshot.ID); err != nil {
+		return err
+	}
+
+	if err := r.step(ctx, "snapshot_available"); err != nil {
+		return err
+	}
+
+	log.Printf("Snapshot %s is available", snapshot.ID)
+
+	// Restore the snapshot to a new volume and clone the source volume
+
+	restored, err := createVolume(ctx, r, provider, resourceName, volumes.CreateOpts{SnapshotID: snapshot.ID}, "restored_")
+
+	if err != nil {
+		return err
+	}
+
+	cloned, err := createVolume(ctx, r, provider, resourceName, volumes.CreateOpts{SourceVolID: volume.ID}, "cloned_")
+
+	if err != nil {
+		return err
+	}
+
+	// Remove everything, the snapshot before the volume it was taken from
+
+	for _, v := range []struct {
+		volume *volumes.Volume
+		step   string
+	}{
+		{volume: restored, step: "restored_volume_deleted"},
+		{volume: cloned, step: "cloned_volume_deleted"},
+	} {
+		if err := deleteVolume(ctx, volumeClient, v.volume.ID); err != nil {
+			return err
+		}
+
+		if err := r.step(ctx, v.step); err != nil {
+			return err
+		}
+	}
+
+	if err := snapshots.Delete(volumeClient, snapshot.ID).ExtractErr(); err != nil {
+		return fmt.Errorf("snapshot deletion failed: %w", err)
+	}
+
+	err = waitDeleted(ctx, "snapshot "+snapshot.ID, func() (string, error) {
+		snapshot, err := snapshots.Get(volumeClient, snapshot.ID).Extract()
+
+		if err != nil {
+			return "", err
+		}
+
+		return snapshot.Status, nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := r.step(ctx, "snapshot_deleted"); err != nil {
+		return err
+	}
+
+	if err := deleteVolume(ctx, volumeClient, volume.ID); err != nil {
+		return err
+	}
+
+	if err := r.step(ctx, "volume_deleted"); err != nil {
+		return err
+	}
+
+	log.Printf("Volumes and snapshot of %s deleted", resourceName)
+
+	if err := r.step(ctx, "end"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// waitSnapshot waits until the snapshot is available
+func waitSnapshot(ctx context.Context, client *gophercloud.ServiceClient, id string) error {
+	for {
+		snapshot, err := snapshots.Get(client, id).Extract()
+
+		if err == nil && snapshot.Status == "available" {
+			return nil
+		}
+
+		if err == nil && strings.HasPrefix(snapshot.Status, "error") {
+			return withReason(reasonResourceError, fmt.Errorf("snapshot %s reached %s status", id, snapshot.Status))
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for snapshot to reach available status")
+		default:
+		}
+
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// deleteVolume deletes the volume and waits until it is gone
+func deleteVolume(ctx context.Context, client *gophercloud.ServiceClient, id string) error {
+	if err := volumes.Delete(client, id, volumes.DeleteOpts{}).ExtractErr(); err != nil {
+		return fmt.Errorf("volume deletion failed: %w", err)
+	}
+
+	return waitDeleted(ctx, "volume "+id, func() (string, error) {
+		volume, err := volumes.Get(client, id).Extract()
+
+		if err != nil {
+			return "", err
+		}
+
+		return volume.Status, nil
+	})
+}
+
+// waitDeleted waits until the resource named what is gone, get returning its
+// status or a 404 error once it is deleted
+func waitDeleted(ctx context.Context, what string, get func() (string, error)) error {
+	for {
+		status, err := get()
+
+		if errors.As(err, &gophercloud.ErrDefault404{}) {
+			return nil
+		}
+
+		if err == nil && strings.HasPrefix(status, "error") {
+			return withReason(reasonResourceError, fmt.Errorf("%s reached %s status", what, status))
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for %s to be deleted", what)
+		default:
+		}
+
+		time.Sleep(1 * time.Second)
+	}
+}
+
+type volumeSnapshotProbe struct{}
+
+func init() {
+	registerProbe(volumeSnapshotProbe{}, 10*time.Minute, false)
+}
+
+func (volumeSnapshotProbe) Name() string {
+	return "volume_snapshot"
+}
+
+func (volumeSnapshotProbe) Description() probeDescription {
+	return probeDescription{
+		success: "'1' when a volume was snapshotted, restored from the snapshot and cloned, then all of them deleted",
+		timing:  "Timestamp of each step for snapshotting, restoring and cloning a volume",
+	}
+}
+
+func (volumeSnapshotProbe) Run(ctx context.Context, r *probeRun) error {
+	return volumeSnapshot(ctx, r)
+}
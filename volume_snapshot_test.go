@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+func TestVolumeSnapshot(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(f *fakeCloud)
+		// reason and step are the reason of the failure and the last step
+		// reached, none on success
+		reason string
+		step   string
+		// volumes and snapshots are the number of resources left
+		volumes   int
+		snapshots int
+	}{
+		{
+			name:  "success",
+			setup: func(f *fakeCloud) {},
+		},
+		{
+			name: "snapshot in error",
+			setup: func(f *fakeCloud) {
+				f.snapshots.transitions = []string{"creating", "error"}
+			},
+			reason:    reasonResourceError,
+			step:      "snapshot_created",
+			volumes:   1,
+			snapshots: 1,
+		},
+		{
+			name: "snapshot deletion failure",
+			setup: func(f *fakeCloud) {
+				f.fail(http.MethodDelete, "/volume/v2/project-1/snapshots", http.StatusInternalServerError, `{}`)
+			},
+			reason:    reasonAPI5xx,
+			step:      "cloned_volume_deleted",
+			volumes:   1,
+			snapshots: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFakeCloud(t)
+			test.setup(f)
+
+			result := runTestProbe(t, testModule("volume_snapshot"), f.cloud())
+
+			switch {
+			case test.reason == "" && !result.success:
+				t.Errorf("got %+v, want success", result)
+			case test.reason != "" && (result.success || result.reason != test.reason || result.step != test.step):
+				t.Errorf("got %+v, want failure with reason %s after step %s", result, test.reason, test.step)
+			}
+
+			if len(f.volumes.objects) != test.volumes || len(f.snapshots.objects) != test.snapshots {
+				t.Errorf("got %d volumes and %d snapshots left, want %d and %d", len(f.volumes.objects), len(f.snapshots.objects), test.volumes, test.snapshots)
+			}
+		})
+	}
+}
+
+func TestWaitDeleted(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	calls := 0
+
+	// The 404 error may come wrapped by the get function
+	err := waitDeleted(ctx, "volume", func() (string, error) {
+		calls++
+
+		if calls < 2 {
+			return "deleting", nil
+		}
+
+		return "", fmt.Errorf("cannot get volume: %w", gophercloud.ErrDefault404{})
+	})
+
+	if err != nil || calls != 2 {
+		t.Errorf("got error %v after %d calls, want success after 2", err, calls)
+	}
+}